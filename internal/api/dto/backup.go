@@ -0,0 +1,85 @@
+package dto
+
+import "time"
+
+type BackupOperate struct {
+	ID              uint   `json:"id"`
+	Type            string `json:"type" validate:"required"`
+	Bucket          string `json:"bucket"`
+	AccessKey       string `json:"accessKey"`
+	Credential      string `json:"credential"`
+	BackupPath      string `json:"backupPath"`
+	Vars            string `json:"vars" validate:"required"`
+	EncryptKey      string `json:"encryptKey"`
+	ClearEncryptKey bool   `json:"clearEncryptKey"`
+}
+
+type BackupInfo struct {
+	ID            uint      `json:"id"`
+	CreatedAt     time.Time `json:"createdAt"`
+	Type          string    `json:"type"`
+	Bucket        string    `json:"bucket"`
+	AccessKey     string    `json:"accessKey"`
+	BackupPath    string    `json:"backupPath"`
+	Vars          string    `json:"vars"`
+	HasEncryptKey bool      `json:"hasEncryptKey"`
+}
+
+type RecordSearch struct {
+	PageInfo
+	From       string `json:"from"`
+	Type       string `json:"type"`
+	CronjobID  uint   `json:"cronjobID"`
+	Name       string `json:"name"`
+	DetailName string `json:"detailName"`
+}
+
+type BackupRecords struct {
+	ID         uint      `json:"id"`
+	CreatedAt  time.Time `json:"createdAt"`
+	From       string    `json:"from"`
+	CronjobID  uint      `json:"cronjobID"`
+	Type       string    `json:"type"`
+	Name       string    `json:"name"`
+	DetailName string    `json:"detailName"`
+	Source     string    `json:"source"`
+	BackupType string    `json:"backupType"`
+	FileDir    string    `json:"fileDir"`
+	FileName   string    `json:"fileName"`
+	Accounts   []string  `json:"accounts"`
+
+	Checksum      string    `json:"checksum"`
+	Size          int64     `json:"size"`
+	VerifyStatus  string    `json:"verifyStatus"`
+	VerifyMessage string    `json:"verifyMessage"`
+	VerifiedAt    time.Time `json:"verifiedAt"`
+}
+
+type DownloadRecord struct {
+	ID      uint   `json:"id" validate:"required"`
+	Account string `json:"account"`
+}
+
+type RecordRecover struct {
+	ID        uint     `json:"id" validate:"required"`
+	TargetDir string   `json:"targetDir" validate:"required"`
+	Mode      string   `json:"mode" validate:"required,oneof=overwrite merge"`
+	Secret    string   `json:"secret"`
+	Files     []string `json:"files"`
+}
+
+type RecordVerify struct {
+	ID   uint   `json:"id" validate:"required"`
+	Mode string `json:"mode" validate:"required,oneof=stat full"`
+}
+
+type RecordFile struct {
+	Path    string    `json:"path"`
+	Type    string    `json:"type"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+type TransferCancel struct {
+	Key string `json:"key" validate:"required"`
+}
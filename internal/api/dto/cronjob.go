@@ -7,16 +7,65 @@ type CronjobCreate struct {
 	Type string `json:"type" validate:"required"`
 	Spec string `json:"spec" validate:"required"`
 
+	Timeout int `json:"timeout" validate:"number,min=0"`
+
+	ConcurrencyPolicy string `json:"concurrencyPolicy" validate:"omitempty,oneof=allow skip queue replace"`
+
+	RetryMaxAttempts int    `json:"retryMaxAttempts" validate:"number,min=0"`
+	RetryBackoff     string `json:"retryBackoff" validate:"omitempty,oneof=fixed exponential"`
+	RetryDelay       int    `json:"retryDelay" validate:"number,min=0"`
+	RetryExitCodes   string `json:"retryExitCodes"`
+
+	NotifyPolicy       string `json:"notifyPolicy" validate:"omitempty,oneof=default custom none"`
+	NotifyOnFailure    bool   `json:"notifyOnFailure"`
+	NotifyOnSuccess    bool   `json:"notifyOnSuccess"`
+	NotifyOverDuration int    `json:"notifyOverDuration" validate:"number,min=0"`
+
 	Script         string `json:"script"`
 	Command        string `json:"command"`
 	ContainerName  string `json:"containerName"`
 	ExclusionRules string `json:"exclusionRules"`
+	URL            string `json:"url"`
 	SourceDir      string `json:"sourceDir"`
 
+	RunAsUser   string       `json:"runAsUser"`
+	RunAsGroup  string       `json:"runAsGroup"`
+	Workdir     string       `json:"workdir"`
+	Interpreter string       `json:"interpreter" validate:"omitempty,oneof=bash sh python"`
+	Envs        []CronjobEnv `json:"envs" validate:"omitempty,dive"`
+	HostIDs     string       `json:"hostIDs"`
+	HostGroupID uint         `json:"hostGroupID"`
+
 	BackupAccounts  string `json:"backupAccounts"`
 	DefaultDownload string `json:"defaultDownload"`
 	RetainCopies    int    `json:"retainCopies" validate:"number,min=1"`
+	RetainDaily     int    `json:"retainDaily" validate:"number,min=0"`
+	RetainWeekly    int    `json:"retainWeekly" validate:"number,min=0"`
+	RetainMonthly   int    `json:"retainMonthly" validate:"number,min=0"`
+	RetainYearly    int    `json:"retainYearly" validate:"number,min=0"`
+	RetainMinAge    int    `json:"retainMinAge" validate:"number,min=0"`
 	Secret          string `json:"secret"`
+	EncryptKey      string `json:"encryptKey"`
+	BackupMode      string `json:"backupMode" validate:"omitempty,oneof=archive dedup"`
+	LogCleanMode    string `json:"logCleanMode" validate:"omitempty,oneof=keep truncate delete"`
+	LogContainers   bool   `json:"logContainers"`
+
+	HttpMethod   string `json:"httpMethod" validate:"omitempty,oneof=GET POST PUT PATCH DELETE HEAD"`
+	HttpHeaders  string `json:"httpHeaders"`
+	HttpBody     string `json:"httpBody"`
+	HttpTimeout  int    `json:"httpTimeout" validate:"number,min=0"`
+	ExpectStatus string `json:"expectStatus"`
+	ExpectBody   string `json:"expectBody"`
+
+	Triggers []CronjobTrigger `json:"triggers" validate:"omitempty,dive"`
+}
+
+// CronjobEnv is an environment variable of a shell cronjob, the value of a secret one is stored
+// encrypted and left empty when the job is loaded, saving it empty keeps the stored value
+type CronjobEnv struct {
+	Key    string `json:"key" yaml:"key" validate:"required"`
+	Value  string `json:"value" yaml:"value"`
+	Secret bool   `json:"secret" yaml:"secret"`
 }
 
 type PageCronjob struct {
@@ -32,6 +81,28 @@ type CronjobInfo struct {
 	Type string `json:"type"`
 	Spec string `json:"spec"`
 
+	Timeout int `json:"timeout"`
+
+	ConcurrencyPolicy string `json:"concurrencyPolicy"`
+
+	RetryMaxAttempts int    `json:"retryMaxAttempts"`
+	RetryBackoff     string `json:"retryBackoff"`
+	RetryDelay       int    `json:"retryDelay"`
+	RetryExitCodes   string `json:"retryExitCodes"`
+
+	NotifyPolicy       string `json:"notifyPolicy"`
+	NotifyOnFailure    bool   `json:"notifyOnFailure"`
+	NotifyOnSuccess    bool   `json:"notifyOnSuccess"`
+	NotifyOverDuration int    `json:"notifyOverDuration"`
+
+	RunAsUser   string       `json:"runAsUser"`
+	RunAsGroup  string       `json:"runAsGroup"`
+	Workdir     string       `json:"workdir"`
+	Interpreter string       `json:"interpreter"`
+	Envs        []CronjobEnv `json:"envs"`
+	HostIDs     string       `json:"hostIDs"`
+	HostGroupID uint         `json:"hostGroupID"`
+
 	Script          string `json:"script"`
 	Command         string `json:"command"`
 	ContainerName   string `json:"containerName"`
@@ -41,10 +112,29 @@ type CronjobInfo struct {
 	BackupAccounts  string `json:"backupAccounts"`
 	DefaultDownload string `json:"defaultDownload"`
 	RetainCopies    int    `json:"retainCopies"`
+	RetainDaily     int    `json:"retainDaily"`
+	RetainWeekly    int    `json:"retainWeekly"`
+	RetainMonthly   int    `json:"retainMonthly"`
+	RetainYearly    int    `json:"retainYearly"`
+	RetainMinAge    int    `json:"retainMinAge"`
 
 	LastRecordTime string `json:"lastRecordTime"`
+	NextRunTime    string `json:"nextRunTime"`
 	Status         string `json:"status"`
 	Secret         string `json:"secret"`
+	HasEncryptKey  bool   `json:"hasEncryptKey"`
+	BackupMode     string `json:"backupMode"`
+	LogCleanMode   string `json:"logCleanMode"`
+	LogContainers  bool   `json:"logContainers"`
+
+	HttpMethod   string `json:"httpMethod"`
+	HttpHeaders  string `json:"httpHeaders"`
+	HttpBody     string `json:"httpBody"`
+	HttpTimeout  int    `json:"httpTimeout"`
+	ExpectStatus string `json:"expectStatus"`
+	ExpectBody   string `json:"expectBody"`
+
+	Triggers []CronjobTrigger `json:"triggers"`
 }
 
 type CronjobUpdate struct {
@@ -52,6 +142,20 @@ type CronjobUpdate struct {
 	Name string `json:"name" validate:"required"`
 	Spec string `json:"spec" validate:"required"`
 
+	Timeout int `json:"timeout" validate:"number,min=0"`
+
+	ConcurrencyPolicy string `json:"concurrencyPolicy" validate:"omitempty,oneof=allow skip queue replace"`
+
+	RetryMaxAttempts int    `json:"retryMaxAttempts" validate:"number,min=0"`
+	RetryBackoff     string `json:"retryBackoff" validate:"omitempty,oneof=fixed exponential"`
+	RetryDelay       int    `json:"retryDelay" validate:"number,min=0"`
+	RetryExitCodes   string `json:"retryExitCodes"`
+
+	NotifyPolicy       string `json:"notifyPolicy" validate:"omitempty,oneof=default custom none"`
+	NotifyOnFailure    bool   `json:"notifyOnFailure"`
+	NotifyOnSuccess    bool   `json:"notifyOnSuccess"`
+	NotifyOverDuration int    `json:"notifyOverDuration" validate:"number,min=0"`
+
 	Script         string `json:"script"`
 	Command        string `json:"command"`
 	ContainerName  string `json:"containerName"`
@@ -59,10 +163,43 @@ type CronjobUpdate struct {
 	URL            string `json:"url"`
 	SourceDir      string `json:"sourceDir"`
 
+	RunAsUser   string       `json:"runAsUser"`
+	RunAsGroup  string       `json:"runAsGroup"`
+	Workdir     string       `json:"workdir"`
+	Interpreter string       `json:"interpreter" validate:"omitempty,oneof=bash sh python"`
+	Envs        []CronjobEnv `json:"envs" validate:"omitempty,dive"`
+	HostIDs     string       `json:"hostIDs"`
+	HostGroupID uint         `json:"hostGroupID"`
+
 	BackupAccounts  string `json:"backupAccounts"`
 	DefaultDownload string `json:"defaultDownload"`
 	RetainCopies    int    `json:"retainCopies" validate:"number,min=1"`
+	RetainDaily     int    `json:"retainDaily" validate:"number,min=0"`
+	RetainWeekly    int    `json:"retainWeekly" validate:"number,min=0"`
+	RetainMonthly   int    `json:"retainMonthly" validate:"number,min=0"`
+	RetainYearly    int    `json:"retainYearly" validate:"number,min=0"`
+	RetainMinAge    int    `json:"retainMinAge" validate:"number,min=0"`
 	Secret          string `json:"secret"`
+	EncryptKey      string `json:"encryptKey"`
+	ClearEncryptKey bool   `json:"clearEncryptKey"`
+	BackupMode      string `json:"backupMode" validate:"omitempty,oneof=archive dedup"`
+	LogCleanMode    string `json:"logCleanMode" validate:"omitempty,oneof=keep truncate delete"`
+	LogContainers   bool   `json:"logContainers"`
+
+	HttpMethod   string `json:"httpMethod" validate:"omitempty,oneof=GET POST PUT PATCH DELETE HEAD"`
+	HttpHeaders  string `json:"httpHeaders"`
+	HttpBody     string `json:"httpBody"`
+	HttpTimeout  int    `json:"httpTimeout" validate:"number,min=0"`
+	ExpectStatus string `json:"expectStatus"`
+	ExpectBody   string `json:"expectBody"`
+
+	Triggers []CronjobTrigger `json:"triggers" validate:"omitempty,dive"`
+}
+
+type CronjobTrigger struct {
+	TargetID   uint   `json:"targetID" validate:"required"`
+	TargetName string `json:"targetName"`
+	Condition  string `json:"condition" validate:"required,oneof=success failed always"`
 }
 
 type CronjobUpdateStatus struct {
@@ -81,6 +218,46 @@ type CronjobClean struct {
 	CronjobID uint `json:"cronjobID" validate:"required"`
 }
 
+type RetentionPreview struct {
+	CronjobID     uint `json:"cronjobID" validate:"required"`
+	RetainCopies  int  `json:"retainCopies" validate:"number,min=1"`
+	RetainDaily   int  `json:"retainDaily" validate:"number,min=0"`
+	RetainWeekly  int  `json:"retainWeekly" validate:"number,min=0"`
+	RetainMonthly int  `json:"retainMonthly" validate:"number,min=0"`
+	RetainYearly  int  `json:"retainYearly" validate:"number,min=0"`
+	RetainMinAge  int  `json:"retainMinAge" validate:"number,min=0"`
+}
+
+type RetentionItem struct {
+	ID      uint      `json:"id"`
+	Name    string    `json:"name"`
+	Time    time.Time `json:"time"`
+	Reasons []string  `json:"reasons"`
+}
+
+type RetentionPreviewResult struct {
+	Keep   []RetentionItem `json:"keep"`
+	Delete []RetentionItem `json:"delete"`
+}
+
+type CronjobSpecPreview struct {
+	Spec  string `json:"spec" validate:"required"`
+	Count int    `json:"count" validate:"number,min=0,max=100"`
+}
+
+type CronjobSpecItem struct {
+	Spec        string `json:"spec"`
+	Description string `json:"description"`
+	Error       string `json:"error"`
+}
+
+type CronjobSpecResult struct {
+	Valid     bool              `json:"valid"`
+	TimeZone  string            `json:"timeZone"`
+	Specs     []CronjobSpecItem `json:"specs"`
+	NextTimes []string          `json:"nextTimes"`
+}
+
 type SearchRecord struct {
 	PageInfo
 	CronjobID int       `json:"cronjobID"`
@@ -98,4 +275,142 @@ type Record struct {
 	TargetPath string `json:"targetPath"`
 	Interval   int    `json:"interval"`
 	File       string `json:"file"`
+
+	StatusCode int     `json:"statusCode"`
+	Latency    float64 `json:"latency"`
+	Excerpt    string  `json:"excerpt"`
+
+	WorkflowRunID uint `json:"workflowRunID"`
+	TriggeredBy   uint `json:"triggeredBy"`
+	Attempt       uint `json:"attempt"`
+	RetryOf       uint `json:"retryOf"`
+
+	Hosts []CronjobHostResult `json:"hosts"`
+}
+
+type CronjobHostResult struct {
+	ID       uint   `json:"id"`
+	HostID   uint   `json:"hostID"`
+	Name     string `json:"name"`
+	Addr     string `json:"addr"`
+	Interval int    `json:"interval"`
+	Records  string `json:"records"`
+	Status   string `json:"status"`
+	Message  string `json:"message"`
+}
+
+type SearchWorkflowRun struct {
+	PageInfo
+	CronjobID uint `json:"cronjobID"`
+}
+
+type WorkflowRunInfo struct {
+	ID         uint           `json:"id"`
+	CronjobID  uint           `json:"cronjobID"`
+	Name       string         `json:"name"`
+	StartTime  string         `json:"startTime"`
+	Interval   int            `json:"interval"`
+	Status     string         `json:"status"`
+	Message    string         `json:"message"`
+	FailedStep string         `json:"failedStep"`
+	Steps      []WorkflowStep `json:"steps"`
+}
+
+type WorkflowStep struct {
+	RecordID    uint   `json:"recordID"`
+	CronjobID   uint   `json:"cronjobID"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	TriggeredBy uint   `json:"triggeredBy"`
+	Attempt     uint   `json:"attempt"`
+	StartTime   string `json:"startTime"`
+	Interval    int    `json:"interval"`
+	Status      string `json:"status"`
+	Message     string `json:"message"`
+}
+
+type CronjobExport struct {
+	IDs    []uint `json:"ids" validate:"required"`
+	Format string `json:"format" validate:"required,oneof=yaml json"`
+}
+
+type CronjobImport struct {
+	Content  string `json:"content" validate:"required"`
+	Conflict string `json:"conflict" validate:"required,oneof=skip rename overwrite"`
+}
+
+type CronjobImportResult struct {
+	Created     []string          `json:"created"`
+	Overwritten []string          `json:"overwritten"`
+	Skipped     []string          `json:"skipped"`
+	Renamed     map[string]string `json:"renamed"`
+	Failed      []string          `json:"failed"`
+}
+
+// CronjobDocument is the versioned document cronjobs are exported to and imported from,
+// secrets and encrypt keys are not part of it
+type CronjobDocument struct {
+	Version    int                 `json:"version" yaml:"version"`
+	ExportedAt time.Time           `json:"exportedAt" yaml:"exportedAt"`
+	Cronjobs   []CronjobDefinition `json:"cronjobs" yaml:"cronjobs"`
+}
+
+type CronjobDefinition struct {
+	Name    string `json:"name" yaml:"name"`
+	Type    string `json:"type" yaml:"type"`
+	Spec    string `json:"spec" yaml:"spec"`
+	Timeout int    `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	ConcurrencyPolicy string `json:"concurrencyPolicy,omitempty" yaml:"concurrencyPolicy,omitempty"`
+
+	Script         string `json:"script,omitempty" yaml:"script,omitempty"`
+	Command        string `json:"command,omitempty" yaml:"command,omitempty"`
+	ContainerName  string `json:"containerName,omitempty" yaml:"containerName,omitempty"`
+	ExclusionRules string `json:"exclusionRules,omitempty" yaml:"exclusionRules,omitempty"`
+	URL            string `json:"url,omitempty" yaml:"url,omitempty"`
+	SourceDir      string `json:"sourceDir,omitempty" yaml:"sourceDir,omitempty"`
+
+	RunAsUser   string       `json:"runAsUser,omitempty" yaml:"runAsUser,omitempty"`
+	RunAsGroup  string       `json:"runAsGroup,omitempty" yaml:"runAsGroup,omitempty"`
+	Workdir     string       `json:"workdir,omitempty" yaml:"workdir,omitempty"`
+	Interpreter string       `json:"interpreter,omitempty" yaml:"interpreter,omitempty"`
+	Envs        []CronjobEnv `json:"envs,omitempty" yaml:"envs,omitempty"`
+	Hosts       []string     `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+	HostGroup   string       `json:"hostGroup,omitempty" yaml:"hostGroup,omitempty"`
+
+	BackupAccounts  string `json:"backupAccounts,omitempty" yaml:"backupAccounts,omitempty"`
+	DefaultDownload string `json:"defaultDownload,omitempty" yaml:"defaultDownload,omitempty"`
+	BackupMode      string `json:"backupMode,omitempty" yaml:"backupMode,omitempty"`
+	RetainCopies    int    `json:"retainCopies" yaml:"retainCopies"`
+	RetainDaily     int    `json:"retainDaily,omitempty" yaml:"retainDaily,omitempty"`
+	RetainWeekly    int    `json:"retainWeekly,omitempty" yaml:"retainWeekly,omitempty"`
+	RetainMonthly   int    `json:"retainMonthly,omitempty" yaml:"retainMonthly,omitempty"`
+	RetainYearly    int    `json:"retainYearly,omitempty" yaml:"retainYearly,omitempty"`
+	RetainMinAge    int    `json:"retainMinAge,omitempty" yaml:"retainMinAge,omitempty"`
+	LogCleanMode    string `json:"logCleanMode,omitempty" yaml:"logCleanMode,omitempty"`
+	LogContainers   bool   `json:"logContainers,omitempty" yaml:"logContainers,omitempty"`
+
+	HttpMethod   string `json:"httpMethod,omitempty" yaml:"httpMethod,omitempty"`
+	HttpHeaders  string `json:"httpHeaders,omitempty" yaml:"httpHeaders,omitempty"`
+	HttpBody     string `json:"httpBody,omitempty" yaml:"httpBody,omitempty"`
+	HttpTimeout  int    `json:"httpTimeout,omitempty" yaml:"httpTimeout,omitempty"`
+	ExpectStatus string `json:"expectStatus,omitempty" yaml:"expectStatus,omitempty"`
+	ExpectBody   string `json:"expectBody,omitempty" yaml:"expectBody,omitempty"`
+
+	RetryMaxAttempts int    `json:"retryMaxAttempts,omitempty" yaml:"retryMaxAttempts,omitempty"`
+	RetryBackoff     string `json:"retryBackoff,omitempty" yaml:"retryBackoff,omitempty"`
+	RetryDelay       int    `json:"retryDelay,omitempty" yaml:"retryDelay,omitempty"`
+	RetryExitCodes   string `json:"retryExitCodes,omitempty" yaml:"retryExitCodes,omitempty"`
+
+	NotifyPolicy       string `json:"notifyPolicy,omitempty" yaml:"notifyPolicy,omitempty"`
+	NotifyOnFailure    bool   `json:"notifyOnFailure,omitempty" yaml:"notifyOnFailure,omitempty"`
+	NotifyOnSuccess    bool   `json:"notifyOnSuccess,omitempty" yaml:"notifyOnSuccess,omitempty"`
+	NotifyOverDuration int    `json:"notifyOverDuration,omitempty" yaml:"notifyOverDuration,omitempty"`
+
+	Triggers []CronjobTriggerDefinition `json:"triggers,omitempty" yaml:"triggers,omitempty"`
+}
+
+type CronjobTriggerDefinition struct {
+	Target    string `json:"target" yaml:"target"`
+	Condition string `json:"condition" yaml:"condition"`
 }
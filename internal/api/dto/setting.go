@@ -57,6 +57,10 @@ type SettingInfo struct {
 	MemoryThreshold string `json:"memoryThreshold"`
 
 	NotificationURL string `json:"notificationURL"`
+
+	CronjobNotifyOnFailure    string `json:"cronjobNotifyOnFailure"`
+	CronjobNotifyOnSuccess    string `json:"cronjobNotifyOnSuccess"`
+	CronjobNotifyOverDuration string `json:"cronjobNotifyOverDuration"`
 }
 
 type SettingUpdate struct {
@@ -0,0 +1,58 @@
+package dto
+
+import "time"
+
+type SnapshotCreate struct {
+	From            string `json:"from" validate:"required"`
+	DefaultDownload string `json:"defaultDownload" validate:"required"`
+	Description     string `json:"description" validate:"max=256"`
+}
+
+type SnapshotRecover struct {
+	ID         uint `json:"id" validate:"required"`
+	IsNew      bool `json:"isNew"`
+	ReDownload bool `json:"reDownload"`
+}
+
+type SnapshotBatchDelete struct {
+	DeleteWithFile bool   `json:"deleteWithFile"`
+	Ids            []uint `json:"ids" validate:"required"`
+}
+
+type UpdateDescription struct {
+	ID          uint   `json:"id" validate:"required"`
+	Description string `json:"description" validate:"max=256"`
+}
+
+type SnapshotInfo struct {
+	ID              uint      `json:"id"`
+	Name            string    `json:"name"`
+	Description     string    `json:"description"`
+	From            string    `json:"from"`
+	DefaultDownload string    `json:"defaultDownload"`
+	Status          string    `json:"status"`
+	Message         string    `json:"message"`
+	CreatedAt       time.Time `json:"createdAt"`
+	Version         string    `json:"version"`
+
+	InterruptStep    string `json:"interruptStep"`
+	RecoverStatus    string `json:"recoverStatus"`
+	RecoverMessage   string `json:"recoverMessage"`
+	LastRecoveredAt  string `json:"lastRecoveredAt"`
+	RollbackStatus   string `json:"rollbackStatus"`
+	RollbackMessage  string `json:"rollbackMessage"`
+	LastRollbackedAt string `json:"lastRollbackedAt"`
+}
+
+type SnapshotStatus struct {
+	Panel      string `json:"panel"`
+	PanelInfo  string `json:"panelInfo"`
+	DaemonJson string `json:"daemonJson"`
+	AppData    string `json:"appData"`
+	PanelData  string `json:"panelData"`
+	BackupData string `json:"backupData"`
+
+	Compress string `json:"compress"`
+	Size     string `json:"size"`
+	Upload   string `json:"upload"`
+}
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"LinuxOnM/internal/api/dto"
+	"LinuxOnM/internal/api/handlers/helper"
+	"LinuxOnM/internal/constant"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListBackup
+// @Tags Backup Account
+// @Summary List backup accounts
+// @Description 获取备份账号列表
+// @Success 200 {array} dto.BackupInfo
+// @Security ApiKeyAuth
+// @Router /backup/search [get]
+func (b *BaseApi) ListBackup(c *gin.Context) {
+	list, err := backupService.List()
+	if err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	helper.SuccessWithData(c, list)
+}
+
+// CreateBackup
+// @Tags Backup Account
+// @Summary Create backup account
+// @Description 创建备份账号
+// @Accept json
+// @Param request body dto.BackupOperate true "request"
+// @Success 200
+// @Security ApiKeyAuth
+// @Router /backup [post]
+// @x-panel-log {"bodyKeys":["type"],"paramKeys":[],"BeforeFunctions":[],"formatZH":"创建备份账号 [type]","formatEN":"create backup account [type]"}
+func (b *BaseApi) CreateBackup(c *gin.Context) {
+	var req dto.BackupOperate
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	if err := backupService.Create(req); err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	helper.SuccessWithData(c, nil)
+}
+
+// UpdateBackup
+// @Tags Backup Account
+// @Summary Update backup account
+// @Description 更新备份账号
+// @Accept json
+// @Param request body dto.BackupOperate true "request"
+// @Success 200
+// @Security ApiKeyAuth
+// @Router /backup/update [post]
+// @x-panel-log {"bodyKeys":["type"],"paramKeys":[],"BeforeFunctions":[],"formatZH":"更新备份账号 [type]","formatEN":"update backup account [type]"}
+func (b *BaseApi) UpdateBackup(c *gin.Context) {
+	var req dto.BackupOperate
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	if err := backupService.Update(req); err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	helper.SuccessWithData(c, nil)
+}
+
+// DeleteBackup
+// @Tags Backup Account
+// @Summary Delete backup account
+// @Description 删除备份账号
+// @Accept json
+// @Param request body dto.OperateByID true "request"
+// @Success 200
+// @Security ApiKeyAuth
+// @Router /backup/del [post]
+// @x-panel-log {"bodyKeys":["id"],"paramKeys":[],"BeforeFunctions":[{"input_column":"id","input_value":"id","isList":false,"db":"backup_accounts","output_column":"type","output_value":"type"}],"formatZH":"删除备份账号 [type]","formatEN":"delete backup account [type]"}
+func (b *BaseApi) DeleteBackup(c *gin.Context) {
+	var req dto.OperateByID
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	if err := backupService.Delete(req.ID); err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	helper.SuccessWithData(c, nil)
+}
+
+// TestBackup
+// @Tags Backup Account
+// @Summary Test backup account connection
+// @Description 测试备份账号连接（写入、读取、删除测试文件）
+// @Accept json
+// @Param request body dto.BackupOperate true "request"
+// @Success 200
+// @Security ApiKeyAuth
+// @Router /backup/test [post]
+func (b *BaseApi) TestBackup(c *gin.Context) {
+	var req dto.BackupOperate
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	if err := backupService.TestConnection(req); err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	helper.SuccessWithData(c, true)
+}
+
+// ListBuckets
+// @Tags Backup Account
+// @Summary List buckets
+// @Description 获取备份账号存储桶列表
+// @Accept json
+// @Param request body dto.BackupOperate true "request"
+// @Success 200 {array} string
+// @Security ApiKeyAuth
+// @Router /backup/buckets [post]
+func (b *BaseApi) ListBuckets(c *gin.Context) {
+	var req dto.BackupOperate
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	buckets, err := backupService.LoadBuckets(req)
+	if err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	helper.SuccessWithData(c, buckets)
+}
+
+// SearchBackupRecords
+// @Tags Backup Account
+// @Summary Page backup records
+// @Description 获取备份记录分页
+// @Accept json
+// @Param request body dto.RecordSearch true "request"
+// @Success 200 {object} dto.PageResult
+// @Security ApiKeyAuth
+// @Router /backup/record/search [post]
+func (b *BaseApi) SearchBackupRecords(c *gin.Context) {
+	var req dto.RecordSearch
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	total, list, err := backupService.SearchRecordsWithPage(req)
+	if err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+
+	helper.SuccessWithData(c, dto.PageResult{
+		Items: list,
+		Total: total,
+	})
+}
+
+// DownloadBackupRecord
+// @Tags Backup Account
+// @Summary Download backup record
+// @Description 下载备份记录文件
+// @Accept json
+// @Param request body dto.DownloadRecord true "request"
+// @Success 200
+// @Security ApiKeyAuth
+// @Router /backup/record/download [post]
+// @x-panel-log {"bodyKeys":["id"],"paramKeys":[],"BeforeFunctions":[{"input_column":"id","input_value":"id","isList":false,"db":"backup_records","output_column":"file_name","output_value":"fileName"}],"formatZH":"下载备份记录 [fileName]","formatEN":"download backup record [fileName]"}
+func (b *BaseApi) DownloadBackupRecord(c *gin.Context) {
+	var req dto.DownloadRecord
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	filePath, err := backupService.DownloadRecord(req)
+	if err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	defer os.RemoveAll(path.Dir(filePath))
+	file, err := os.Open(filePath)
+	if err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	defer file.Close()
+	info, _ := file.Stat()
+
+	c.Header("Content-Length", strconv.FormatInt(info.Size(), 10))
+	c.Header("Content-Disposition", "attachment; filename*=utf-8''"+url.PathEscape(info.Name()))
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), file)
+}
+
+// RecoverBackupRecord
+// @Tags Backup Account
+// @Summary Recover directory backup
+// @Description 从备份记录恢复目录
+// @Accept json
+// @Param request body dto.RecordRecover true "request"
+// @Success 200
+// @Security ApiKeyAuth
+// @Router /backup/record/recover [post]
+// @x-panel-log {"bodyKeys":["id","targetDir"],"paramKeys":[],"BeforeFunctions":[{"input_column":"id","input_value":"id","isList":false,"db":"backup_records","output_column":"file_name","output_value":"fileName"}],"formatZH":"从备份 [fileName] 恢复目录 [targetDir]","formatEN":"recover [targetDir] from backup [fileName]"}
+func (b *BaseApi) RecoverBackupRecord(c *gin.Context) {
+	var req dto.RecordRecover
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	if err := backupService.RecoverRecord(req); err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	helper.SuccessWithData(c, nil)
+}
+
+// VerifyBackupRecord
+// @Tags Backup Account
+// @Summary Verify backup record
+// @Description 校验备份记录完整性
+// @Accept json
+// @Param request body dto.RecordVerify true "request"
+// @Success 200
+// @Security ApiKeyAuth
+// @Router /backup/record/verify [post]
+// @x-panel-log {"bodyKeys":["id","mode"],"paramKeys":[],"BeforeFunctions":[{"input_column":"id","input_value":"id","isList":false,"db":"backup_records","output_column":"file_name","output_value":"fileName"}],"formatZH":"校验备份 [fileName] [mode]","formatEN":"verify backup [fileName] [mode]"}
+func (b *BaseApi) VerifyBackupRecord(c *gin.Context) {
+	var req dto.RecordVerify
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	if err := backupService.VerifyRecord(req); err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	helper.SuccessWithData(c, nil)
+}
+
+// ListBackupRecordFiles
+// @Tags Backup Account
+// @Summary List files of deduplicated backup
+// @Description 获取增量备份文件列表
+// @Accept json
+// @Param request body dto.OperateByID true "request"
+// @Success 200 {array} dto.RecordFile
+// @Security ApiKeyAuth
+// @Router /backup/record/files [post]
+func (b *BaseApi) ListBackupRecordFiles(c *gin.Context) {
+	var req dto.OperateByID
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	list, err := backupService.ListRecordFiles(req)
+	if err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	helper.SuccessWithData(c, list)
+}
+
+// ListBackupTransfers
+// @Tags Backup Account
+// @Summary List running backup transfers
+// @Description 获取进行中的备份传输
+// @Success 200 {array} storage_client.TransferProcess
+// @Security ApiKeyAuth
+// @Router /backup/transfers [get]
+func (b *BaseApi) ListBackupTransfers(c *gin.Context) {
+	helper.SuccessWithData(c, backupService.ListTransfers())
+}
+
+// CancelBackupTransfer
+// @Tags Backup Account
+// @Summary Cancel backup transfer
+// @Description 取消备份传输
+// @Accept json
+// @Param request body dto.TransferCancel true "request"
+// @Success 200
+// @Security ApiKeyAuth
+// @Router /backup/transfer/cancel [post]
+// @x-panel-log {"bodyKeys":["key"],"paramKeys":[],"BeforeFunctions":[],"formatZH":"取消备份传输 [key]","formatEN":"cancel backup transfer [key]"}
+func (b *BaseApi) CancelBackupTransfer(c *gin.Context) {
+	var req dto.TransferCancel
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	if err := backupService.CancelTransfer(req.Key); err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	helper.SuccessWithData(c, nil)
+}
@@ -4,8 +4,14 @@ import (
 	"LinuxOnM/internal/api/dto"
 	"LinuxOnM/internal/api/handlers/helper"
 	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/global"
 	"LinuxOnM/internal/utils/common"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 )
 
@@ -82,6 +88,56 @@ func (b *BaseApi) UpdateCronjob(c *gin.Context) {
 	helper.SuccessWithData(c, nil)
 }
 
+// ExportCronjob
+// @Tags Cronjob
+// @Summary Export cronjobs
+// @Description 导出计划任务
+// @Accept json
+// @Param request body dto.CronjobExport true "request"
+// @Success 200
+// @Security ApiKeyAuth
+// @Router /cronjob/export [post]
+// @x-panel-log {"bodyKeys":["format"],"paramKeys":[],"BeforeFunctions":[],"formatZH":"导出计划任务 [format]","formatEN":"export cronjobs [format]"}
+func (b *BaseApi) ExportCronjob(c *gin.Context) {
+	var req dto.CronjobExport
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	content, err := cronjobService.Export(req)
+	if err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	fileName := fmt.Sprintf("cronjobs_%s.%s", time.Now().Format(constant.DateTimeSlimLayout), req.Format)
+	c.Header("Content-Disposition", "attachment; filename*=utf-8''"+url.PathEscape(fileName))
+	c.Data(http.StatusOK, "application/octet-stream", content)
+}
+
+// ImportCronjob
+// @Tags Cronjob
+// @Summary Import cronjobs
+// @Description 导入计划任务
+// @Accept json
+// @Param request body dto.CronjobImport true "request"
+// @Success 200 {object} dto.CronjobImportResult
+// @Security ApiKeyAuth
+// @Router /cronjob/import [post]
+// @x-panel-log {"bodyKeys":["conflict"],"paramKeys":[],"BeforeFunctions":[],"formatZH":"导入计划任务 [conflict]","formatEN":"import cronjobs [conflict]"}
+func (b *BaseApi) ImportCronjob(c *gin.Context) {
+	var req dto.CronjobImport
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	result, err := cronjobService.Import(req)
+	if err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	helper.SuccessWithData(c, result)
+}
+
 // UpdateCronjobStatus
 // @Tags Cronjob
 // @Summary Update cronjob status
@@ -159,6 +215,33 @@ func (b *BaseApi) SearchJobRecords(c *gin.Context) {
 	})
 }
 
+// SearchWorkflowRuns
+// @Tags Cronjob
+// @Summary Page workflow runs
+// @Description 获取计划任务工作流执行记录
+// @Accept json
+// @Param request body dto.SearchWorkflowRun true "request"
+// @Success 200 {object} dto.PageResult
+// @Security ApiKeyAuth
+// @Router /cronjob/workflow/search [post]
+func (b *BaseApi) SearchWorkflowRuns(c *gin.Context) {
+	var req dto.SearchWorkflowRun
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	total, list, err := cronjobService.SearchWorkflowRuns(req)
+	if err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+
+	helper.SuccessWithData(c, dto.PageResult{
+		Items: list,
+		Total: total,
+	})
+}
+
 // LoadRecordLog
 // @Tags Cronjob
 // @Summary Load Cronjob record log
@@ -177,6 +260,78 @@ func (b *BaseApi) LoadRecordLog(c *gin.Context) {
 	helper.SuccessWithData(c, content)
 }
 
+// LoadHostRecordLog
+// @Tags Cronjob
+// @Summary Load Cronjob record log of a remote host
+// @Description 获取计划任务记录在远程主机上的日志
+// @Accept json
+// @Param request body dto.OperateByID true "request"
+// @Success 200
+// @Security ApiKeyAuth
+// @Router /cronjob/record/host/log [post]
+func (b *BaseApi) LoadHostRecordLog(c *gin.Context) {
+	var req dto.OperateByID
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+	content := cronjobService.LoadHostRecordLog(req)
+	helper.SuccessWithData(c, content)
+}
+
+// StopExecution
+// @Tags Cronjob
+// @Summary Stop a running job record
+// @Description 停止正在执行的计划任务
+// @Accept json
+// @Param request body dto.OperateByID true "request"
+// @Success 200
+// @Security ApiKeyAuth
+// @Router /cronjob/record/stop [post]
+// @x-panel-log {"bodyKeys":["id"],"paramKeys":[],"BeforeFunctions":[],"formatZH":"停止计划任务执行记录 [id]","formatEN":"stop the execution of cronjob record [id]"}
+func (b *BaseApi) StopExecution(c *gin.Context) {
+	var req dto.OperateByID
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	if err := cronjobService.StopExecution(req.ID); err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	helper.SuccessWithData(c, nil)
+}
+
+// TailRecordLog
+// @Tags Cronjob
+// @Summary Tail job record log
+// @Description 实时查看计划任务记录日志
+// @Param id query string true "记录 ID"
+// @Param tail query string false "显示行数"
+// @Param follow query string false "是否追踪"
+// @Security ApiKeyAuth
+// @Router /cronjob/record/tail [get]
+func (b *BaseApi) TailRecordLog(c *gin.Context) {
+	wsConn, err := upGrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		global.LOG.Errorf("gin context http handler failed, err: %v", err)
+		return
+	}
+	defer wsConn.Close()
+
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		_ = wsConn.WriteMessage(websocket.TextMessage, []byte(err.Error()))
+		return
+	}
+	tail, _ := strconv.Atoi(c.Query("tail"))
+	follow := c.Query("follow") == "true"
+
+	if err := cronjobService.TailRecordLog(wsConn, uint(id), tail, follow); err != nil {
+		_ = wsConn.WriteMessage(websocket.TextMessage, []byte(err.Error()))
+		return
+	}
+}
+
 // CleanRecord
 // @Tags Cronjob
 // @Summary Clean job records
@@ -201,6 +356,52 @@ func (b *BaseApi) CleanRecord(c *gin.Context) {
 	helper.SuccessWithData(c, nil)
 }
 
+// PreviewRetention
+// @Tags Cronjob
+// @Summary Preview cronjob retention policy
+// @Description 预览计划任务保留策略
+// @Accept json
+// @Param request body dto.RetentionPreview true "request"
+// @Success 200 {object} dto.RetentionPreviewResult
+// @Security ApiKeyAuth
+// @Router /cronjob/retention/preview [post]
+func (b *BaseApi) PreviewRetention(c *gin.Context) {
+	var req dto.RetentionPreview
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	result, err := cronjobService.PreviewRetention(req)
+	if err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	helper.SuccessWithData(c, result)
+}
+
+// PreviewSpec
+// @Tags Cronjob
+// @Summary Validate cronjob spec and preview next run times
+// @Description 校验计划任务执行周期并预览执行时间
+// @Accept json
+// @Param request body dto.CronjobSpecPreview true "request"
+// @Success 200 {object} dto.CronjobSpecResult
+// @Security ApiKeyAuth
+// @Router /cronjob/spec/preview [post]
+func (b *BaseApi) PreviewSpec(c *gin.Context) {
+	var req dto.CronjobSpecPreview
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	result, err := cronjobService.PreviewSpec(req)
+	if err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	helper.SuccessWithData(c, result)
+}
+
 // DeleteCronjob
 // @Tags Cronjob
 // @Summary Delete cronjob
@@ -21,6 +21,7 @@ var (
 	settingService         = services.NewISettingService()
 	processService         = services.NewIProcessService()
 	cronjobService         = services.NewICronjobService()
+	backupService          = services.NewIBackupService()
 	firewallService        = services.NewIFirewallService()
 	containerService       = services.NewIContainerService()
 	imageService           = services.NewIImageService()
@@ -28,4 +29,5 @@ var (
 	imageRepoService       = services.NewIImageRepoService()
 	composeTemplateService = services.NewIComposeTemplateService()
 	licenseService         = services.NewILicenseService()
+	snapshotService        = services.NewISnapshotService()
 )
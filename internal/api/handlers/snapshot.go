@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"LinuxOnM/internal/api/dto"
+	"LinuxOnM/internal/api/handlers/helper"
+	"LinuxOnM/internal/constant"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateSnapshot
+// @Tags System Setting
+// @Summary Create system snapshot
+// @Description 创建系统快照
+// @Accept json
+// @Param request body dto.SnapshotCreate true "request"
+// @Success 200
+// @Security ApiKeyAuth
+// @Router /setting/snapshot [post]
+// @x-panel-log {"bodyKeys":["from","description"],"paramKeys":[],"BeforeFunctions":[],"formatZH":"创建系统快照 [description] 到 [from]","formatEN":"Create system backup [description] to [from]"}
+func (b *BaseApi) CreateSnapshot(c *gin.Context) {
+	var req dto.SnapshotCreate
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	if err := snapshotService.SnapshotCreate(req); err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	helper.SuccessWithData(c, nil)
+}
+
+// SearchSnapshot
+// @Tags System Setting
+// @Summary Page system snapshot
+// @Description 获取系统快照列表分页
+// @Accept json
+// @Param request body dto.SearchWithPage true "request"
+// @Success 200 {object} dto.PageResult
+// @Security ApiKeyAuth
+// @Router /setting/snapshot/search [post]
+func (b *BaseApi) SearchSnapshot(c *gin.Context) {
+	var req dto.SearchWithPage
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	total, list, err := snapshotService.SearchWithPage(req)
+	if err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+
+	helper.SuccessWithData(c, dto.PageResult{
+		Items: list,
+		Total: total,
+	})
+}
+
+// LoadSnapshotStatus
+// @Tags System Setting
+// @Summary Load system snapshot status
+// @Description 获取系统快照状态
+// @Accept json
+// @Param request body dto.OperateByID true "request"
+// @Success 200 {object} dto.SnapshotStatus
+// @Security ApiKeyAuth
+// @Router /setting/snapshot/status [post]
+func (b *BaseApi) LoadSnapshotStatus(c *gin.Context) {
+	var req dto.OperateByID
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	data, err := snapshotService.LoadSnapshotStatus(req.ID)
+	if err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	helper.SuccessWithData(c, data)
+}
+
+// UpdateSnapshotDescription
+// @Tags System Setting
+// @Summary Update system snapshot description
+// @Description 更新系统快照描述信息
+// @Accept json
+// @Param request body dto.UpdateDescription true "request"
+// @Success 200
+// @Security ApiKeyAuth
+// @Router /setting/snapshot/description/update [post]
+// @x-panel-log {"bodyKeys":["id","description"],"paramKeys":[],"BeforeFunctions":[{"input_column":"id","input_value":"id","isList":false,"db":"snapshots","output_column":"name","output_value":"name"}],"formatZH":"快照 [name] 描述信息修改 [description]","formatEN":"The description of the snapshot [name] is modified => [description]"}
+func (b *BaseApi) UpdateSnapshotDescription(c *gin.Context) {
+	var req dto.UpdateDescription
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	if err := snapshotService.UpdateDescription(req); err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	helper.SuccessWithData(c, nil)
+}
+
+// DeleteSnapshot
+// @Tags System Setting
+// @Summary Delete system snapshot
+// @Description 删除系统快照
+// @Accept json
+// @Param request body dto.SnapshotBatchDelete true "request"
+// @Success 200
+// @Security ApiKeyAuth
+// @Router /setting/snapshot/del [post]
+// @x-panel-log {"bodyKeys":["ids"],"paramKeys":[],"BeforeFunctions":[{"input_column":"id","input_value":"ids","isList":true,"db":"snapshots","output_column":"name","output_value":"name"}],"formatZH":"删除系统快照 [name]","formatEN":"Delete system backup [name]"}
+func (b *BaseApi) DeleteSnapshot(c *gin.Context) {
+	var req dto.SnapshotBatchDelete
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	if err := snapshotService.Delete(req); err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	helper.SuccessWithData(c, nil)
+}
+
+// RecoverSnapshot
+// @Tags System Setting
+// @Summary Recover system snapshot
+// @Description 从系统快照恢复
+// @Accept json
+// @Param request body dto.SnapshotRecover true "request"
+// @Success 200
+// @Security ApiKeyAuth
+// @Router /setting/snapshot/recover [post]
+// @x-panel-log {"bodyKeys":["id"],"paramKeys":[],"BeforeFunctions":[{"input_column":"id","input_value":"id","isList":false,"db":"snapshots","output_column":"name","output_value":"name"}],"formatZH":"从系统快照 [name] 恢复","formatEN":"Recover from system backup [name]"}
+func (b *BaseApi) RecoverSnapshot(c *gin.Context) {
+	var req dto.SnapshotRecover
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	if err := snapshotService.SnapshotRecover(req); err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	helper.SuccessWithData(c, nil)
+}
+
+// RollbackSnapshot
+// @Tags System Setting
+// @Summary Rollback system snapshot
+// @Description 从系统快照回滚
+// @Accept json
+// @Param request body dto.SnapshotRecover true "request"
+// @Success 200
+// @Security ApiKeyAuth
+// @Router /setting/snapshot/rollback [post]
+// @x-panel-log {"bodyKeys":["id"],"paramKeys":[],"BeforeFunctions":[{"input_column":"id","input_value":"id","isList":false,"db":"snapshots","output_column":"name","output_value":"name"}],"formatZH":"从系统快照 [name] 回滚","formatEN":"Rollback from system backup [name]"}
+func (b *BaseApi) RollbackSnapshot(c *gin.Context) {
+	var req dto.SnapshotRecover
+	if err := helper.CheckBindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	if err := snapshotService.SnapshotRollback(req); err != nil {
+		helper.ErrorWithDetail(c, constant.CodeErrInternalServer, constant.ErrTypeInternalServer, err)
+		return
+	}
+	helper.SuccessWithData(c, nil)
+}
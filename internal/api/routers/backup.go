@@ -0,0 +1,29 @@
+package routers
+
+import (
+	handler "LinuxOnM/internal/api/handlers"
+	"LinuxOnM/internal/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+type BackupRouter struct{}
+
+func (s *BackupRouter) InitRouter(Router *gin.RouterGroup) {
+	backupRouter := Router.Group("backup").Use(middleware.PasswordExpired())
+	baseApi := handler.ApiGroupApp.BaseApi
+	{
+		backupRouter.GET("/search", baseApi.ListBackup)
+		backupRouter.POST("", baseApi.CreateBackup)
+		backupRouter.POST("/del", baseApi.DeleteBackup)
+		backupRouter.POST("/update", baseApi.UpdateBackup)
+		backupRouter.POST("/test", baseApi.TestBackup)
+		backupRouter.POST("/buckets", baseApi.ListBuckets)
+		backupRouter.POST("/record/search", baseApi.SearchBackupRecords)
+		backupRouter.POST("/record/download", baseApi.DownloadBackupRecord)
+		backupRouter.POST("/record/recover", baseApi.RecoverBackupRecord)
+		backupRouter.POST("/record/verify", baseApi.VerifyBackupRecord)
+		backupRouter.POST("/record/files", baseApi.ListBackupRecordFiles)
+		backupRouter.GET("/transfers", baseApi.ListBackupTransfers)
+		backupRouter.POST("/transfer/cancel", baseApi.CancelBackupTransfer)
+	}
+}
@@ -11,6 +11,7 @@ func commonGroups() []CommonRouter {
 		&GroupRouter{},
 		&SettingRouter{},
 		&CronjobRouter{},
+		&BackupRouter{},
 		&ProcessRouter{},
 		&ContainerRouter{},
 		&LicenseRouter{},
@@ -16,10 +16,18 @@ func (s *CronjobRouter) InitRouter(Router *gin.RouterGroup) {
 		cmdRouter.POST("/del", baseApi.DeleteCronjob)
 		cmdRouter.POST("/search", baseApi.SearchCronjob)
 		cmdRouter.POST("/update", baseApi.UpdateCronjob)
+		cmdRouter.POST("/export", baseApi.ExportCronjob)
+		cmdRouter.POST("/import", baseApi.ImportCronjob)
 		cmdRouter.POST("/status", baseApi.UpdateCronjobStatus)
 		cmdRouter.POST("/handle", baseApi.HandleOnce)
 		cmdRouter.POST("/record/search", baseApi.SearchJobRecords)
 		cmdRouter.POST("/record/log", baseApi.LoadRecordLog)
+		cmdRouter.POST("/record/host/log", baseApi.LoadHostRecordLog)
+		cmdRouter.GET("/record/tail", baseApi.TailRecordLog)
 		cmdRouter.POST("/record/clean", baseApi.CleanRecord)
+		cmdRouter.POST("/record/stop", baseApi.StopExecution)
+		cmdRouter.POST("/retention/preview", baseApi.PreviewRetention)
+		cmdRouter.POST("/spec/preview", baseApi.PreviewSpec)
+		cmdRouter.POST("/workflow/search", baseApi.SearchWorkflowRuns)
 	}
 }
@@ -24,5 +24,13 @@ func (s *SettingRouter) InitRouter(Router *gin.RouterGroup) {
 		settingRouter.POST("/ssl/update", baseApi.UpdateSSL)
 		settingRouter.GET("/ssl/info", baseApi.LoadFromCert)
 		settingRouter.POST("/ssl/download", baseApi.DownloadSSL)
+
+		settingRouter.POST("/snapshot", baseApi.CreateSnapshot)
+		settingRouter.POST("/snapshot/search", baseApi.SearchSnapshot)
+		settingRouter.POST("/snapshot/status", baseApi.LoadSnapshotStatus)
+		settingRouter.POST("/snapshot/description/update", baseApi.UpdateSnapshotDescription)
+		settingRouter.POST("/snapshot/del", baseApi.DeleteSnapshot)
+		settingRouter.POST("/snapshot/recover", baseApi.RecoverSnapshot)
+		settingRouter.POST("/snapshot/rollback", baseApi.RollbackSnapshot)
 	}
 }
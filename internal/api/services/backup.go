@@ -1,14 +1,46 @@
 package services
 
 import (
+	"LinuxOnM/internal/api/dto"
+	"LinuxOnM/internal/buserr"
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/global"
 	"LinuxOnM/internal/models"
+	"LinuxOnM/internal/utils/common"
+	"LinuxOnM/internal/utils/copier"
+	"LinuxOnM/internal/utils/encrypt"
 	"LinuxOnM/internal/utils/storage_client"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 type BackupService struct{}
 
 type IBackupService interface {
+	List() ([]dto.BackupInfo, error)
+	Create(req dto.BackupOperate) error
+	Update(req dto.BackupOperate) error
+	Delete(id uint) error
+	TestConnection(req dto.BackupOperate) error
+	LoadBuckets(req dto.BackupOperate) ([]interface{}, error)
+
+	SearchRecordsWithPage(search dto.RecordSearch) (int64, []dto.BackupRecords, error)
+	DownloadRecord(req dto.DownloadRecord) (string, error)
+	RecoverRecord(req dto.RecordRecover) error
+	VerifyRecord(req dto.RecordVerify) error
+	ListRecordFiles(req dto.OperateByID) ([]dto.RecordFile, error)
+
+	ListTransfers() []storage_client.TransferProcess
+	CancelTransfer(key string) error
+
 	NewClient(backup *models.BackupAccount) (storage_client.StorageClient, error)
 }
 
@@ -16,12 +48,164 @@ func NewIBackupService() IBackupService {
 	return &BackupService{}
 }
 
+func (u *BackupService) List() ([]dto.BackupInfo, error) {
+	accounts, err := backupRepo.List(commonRepo.WithOrderBy("created_at desc"))
+	if err != nil {
+		return nil, err
+	}
+	var datas []dto.BackupInfo
+	for _, account := range accounts {
+		var item dto.BackupInfo
+		if err := copier.Copy(&item, &account); err != nil {
+			return nil, errors.WithMessage(constant.ErrStructTransform, err.Error())
+		}
+		item.AccessKey, err = decryptBackupKey(account.AccessKey)
+		if err != nil {
+			return nil, err
+		}
+		item.HasEncryptKey = len(account.EncryptKey) != 0
+		datas = append(datas, item)
+	}
+	return datas, nil
+}
+
+func (u *BackupService) Create(req dto.BackupOperate) error {
+	backup, _ := backupRepo.Get(commonRepo.WithByType(req.Type))
+	if backup.ID != 0 {
+		return constant.ErrRecordExist
+	}
+	if err := copier.Copy(&backup, &req); err != nil {
+		return errors.WithMessage(constant.ErrStructTransform, err.Error())
+	}
+	if err := checkBackupVars(backup.Vars); err != nil {
+		return err
+	}
+	var err error
+	backup.AccessKey, err = encryptBackupKey(req.AccessKey)
+	if err != nil {
+		return err
+	}
+	backup.Credential, err = encryptBackupKey(req.Credential)
+	if err != nil {
+		return err
+	}
+	backup.EncryptKey, err = encryptBackupKey(req.EncryptKey)
+	if err != nil {
+		return err
+	}
+	return backupRepo.Create(&backup)
+}
+
+func (u *BackupService) Update(req dto.BackupOperate) error {
+	backup, _ := backupRepo.Get(commonRepo.WithByID(req.ID))
+	if backup.ID == 0 {
+		return constant.ErrRecordNotFound
+	}
+	if err := checkBackupVars(req.Vars); err != nil {
+		return err
+	}
+	upMap := make(map[string]interface{})
+	if len(req.AccessKey) != 0 {
+		accessKey, err := encryptBackupKey(req.AccessKey)
+		if err != nil {
+			return err
+		}
+		upMap["access_key"] = accessKey
+	}
+	if len(req.Credential) != 0 {
+		credential, err := encryptBackupKey(req.Credential)
+		if err != nil {
+			return err
+		}
+		upMap["credential"] = credential
+	}
+	// an empty passphrase keeps the stored one, encryption is turned off with clearEncryptKey
+	if req.ClearEncryptKey {
+		upMap["encrypt_key"] = ""
+	} else if len(req.EncryptKey) != 0 {
+		encryptKey, err := encryptBackupKey(req.EncryptKey)
+		if err != nil {
+			return err
+		}
+		upMap["encrypt_key"] = encryptKey
+	}
+	upMap["bucket"] = req.Bucket
+	upMap["backup_path"] = req.BackupPath
+	upMap["vars"] = req.Vars
+	return backupRepo.Update(backup.ID, upMap)
+}
+
+func (u *BackupService) Delete(id uint) error {
+	backup, _ := backupRepo.Get(commonRepo.WithByID(id))
+	if backup.ID == 0 {
+		return constant.ErrRecordNotFound
+	}
+	if backup.Type == constant.Local {
+		return buserr.New(constant.ErrBackupLocalDelete)
+	}
+	cronjobs, _ := cronjobRepo.List()
+	for _, cronjob := range cronjobs {
+		for _, account := range strings.Split(cronjob.BackupAccounts, ",") {
+			if account == backup.Type {
+				return buserr.WithName(constant.ErrBackupInUsed, cronjob.Name)
+			}
+		}
+	}
+	return backupRepo.Delete(commonRepo.WithByID(id))
+}
+
+func (u *BackupService) TestConnection(req dto.BackupOperate) error {
+	backup, err := loadOperateAccount(req)
+	if err != nil {
+		return err
+	}
+	client, err := u.NewClient(&backup)
+	if err != nil {
+		return buserr.WithDetail(constant.ErrBackupCheck, fmt.Sprintf("connect failed, err: %v", err), err)
+	}
+	return checkBackupConn(client, loadBackupPath(backup))
+}
+
+func (u *BackupService) LoadBuckets(req dto.BackupOperate) ([]interface{}, error) {
+	backup, err := loadOperateAccount(req)
+	if err != nil {
+		return nil, err
+	}
+	client, err := u.NewClient(&backup)
+	if err != nil {
+		return nil, err
+	}
+	return client.ListBuckets()
+}
+
 func (u *BackupService) NewClient(backup *models.BackupAccount) (storage_client.StorageClient, error) {
 	varMap := make(map[string]interface{})
 	if err := json.Unmarshal([]byte(backup.Vars), &varMap); err != nil {
 		return nil, err
 	}
+	accessKey, err := encrypt.StringDecrypt(backup.AccessKey)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := encrypt.StringDecrypt(backup.Credential)
+	if err != nil {
+		return nil, err
+	}
 	varMap["bucket"] = backup.Bucket
+	switch backup.Type {
+	case constant.S3:
+		varMap["accessKey"] = accessKey
+		varMap["secretKey"] = credential
+	case constant.Sftp:
+		varMap["username"] = accessKey
+		varMap["password"] = credential
+		if err := loadSftpHostVars(varMap); err != nil {
+			return nil, err
+		}
+	case constant.WebDAV:
+		varMap["username"] = accessKey
+		varMap["password"] = credential
+	}
 
 	backClient, err := storage_client.NewStorageClient(backup.Type, varMap)
 	if err != nil {
@@ -30,3 +214,133 @@ func (u *BackupService) NewClient(backup *models.BackupAccount) (storage_client.
 
 	return backClient, nil
 }
+
+// loadSftpHostVars fills the connection info from an existing host when the account references one by hostID
+func loadSftpHostVars(varMap map[string]interface{}) error {
+	hostIDItem, ok := varMap["hostID"]
+	if !ok {
+		return nil
+	}
+	hostID, _ := strconv.Atoi(fmt.Sprintf("%v", hostIDItem))
+	if hostID == 0 {
+		return nil
+	}
+	host, err := NewIHostService().GetHostInfo(uint(hostID))
+	if err != nil {
+		return err
+	}
+	varMap["address"] = host.Addr
+	varMap["port"] = host.Port
+	varMap["username"] = host.User
+	varMap["authMode"] = host.AuthMode
+	if host.AuthMode == "key" {
+		varMap["password"] = host.PrivateKey
+		varMap["passPhrase"] = host.PassPhrase
+	} else {
+		varMap["password"] = host.Password
+	}
+	return nil
+}
+
+// loadOperateAccount builds an encrypted account from the request, the stored
+// access key and credential are reused when an existing account is tested without resending them
+func loadOperateAccount(req dto.BackupOperate) (models.BackupAccount, error) {
+	var backup models.BackupAccount
+	if err := copier.Copy(&backup, &req); err != nil {
+		return backup, errors.WithMessage(constant.ErrStructTransform, err.Error())
+	}
+	if err := checkBackupVars(backup.Vars); err != nil {
+		return backup, err
+	}
+	var oldBackup models.BackupAccount
+	if req.ID != 0 {
+		oldBackup, _ = backupRepo.Get(commonRepo.WithByID(req.ID))
+	}
+	var err error
+	backup.AccessKey = oldBackup.AccessKey
+	if len(req.AccessKey) != 0 {
+		if backup.AccessKey, err = encryptBackupKey(req.AccessKey); err != nil {
+			return backup, err
+		}
+	}
+	backup.Credential = oldBackup.Credential
+	if len(req.Credential) != 0 {
+		if backup.Credential, err = encryptBackupKey(req.Credential); err != nil {
+			return backup, err
+		}
+	}
+	return backup, nil
+}
+
+func loadBackupPath(backup models.BackupAccount) string {
+	if backup.BackupPath != "/" {
+		return strings.TrimPrefix(backup.BackupPath, "/")
+	}
+	return backup.BackupPath
+}
+
+func checkBackupVars(vars string) error {
+	varMap := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(vars), &varMap); err != nil {
+		return errors.WithMessage(constant.ErrInvalidParams, err.Error())
+	}
+	return nil
+}
+
+// encryptBackupKey works like HostService.EncryptHost, secrets are sent base64 encoded
+func encryptBackupKey(itemVal string) (string, error) {
+	if len(itemVal) == 0 {
+		return "", nil
+	}
+	keyItem, err := base64.StdEncoding.DecodeString(itemVal)
+	if err != nil {
+		return "", err
+	}
+	return encrypt.StringEncrypt(string(keyItem))
+}
+
+// decryptBackupKey returns a stored secret in the base64 encoding encryptBackupKey accepts
+func decryptBackupKey(itemVal string) (string, error) {
+	keyItem, err := encrypt.StringDecrypt(itemVal)
+	if err != nil || len(keyItem) == 0 {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString([]byte(keyItem)), nil
+}
+
+// checkBackupConn performs a write/read/delete probe against the backup path
+func checkBackupConn(client storage_client.StorageClient, backupPath string) error {
+	localDir := path.Join(global.CONF.System.TmpDir, "backup_check")
+	if err := os.MkdirAll(localDir, os.ModePerm); err != nil {
+		return err
+	}
+	fileName := fmt.Sprintf("linuxonm_check_%s.txt", common.RandStrAndNum(8))
+	srcFile := path.Join(localDir, fileName)
+	dstFile := path.Join(localDir, "download", fileName)
+	defer func() {
+		_ = os.Remove(srcFile)
+		_ = os.Remove(dstFile)
+	}()
+	content := fmt.Sprintf("LinuxOnM backup account check at %s", time.Now().Format(constant.DateTimeLayout))
+	if err := os.WriteFile(srcFile, []byte(content), 0640); err != nil {
+		return err
+	}
+
+	target := path.Join(backupPath, fileName)
+	if _, err := client.Upload(srcFile, target); err != nil {
+		return buserr.WithDetail(constant.ErrBackupCheck, fmt.Sprintf("write failed, err: %v", err), err)
+	}
+	if _, err := client.Download(target, dstFile); err != nil {
+		_, _ = client.Delete(target)
+		return buserr.WithDetail(constant.ErrBackupCheck, fmt.Sprintf("read failed, err: %v", err), err)
+	}
+	downloadContent, err := os.ReadFile(dstFile)
+	if err != nil || string(downloadContent) != content {
+		_, _ = client.Delete(target)
+		return buserr.WithDetail(constant.ErrBackupCheck, "the content read back does not match the content written", err)
+	}
+	if _, err := client.Delete(target); err != nil {
+		return buserr.WithDetail(constant.ErrBackupCheck, fmt.Sprintf("delete failed, err: %v", err), err)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"LinuxOnM/internal/api/dto"
+	"LinuxOnM/internal/buserr"
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/global"
+	"LinuxOnM/internal/models"
+	"LinuxOnM/internal/utils/common"
+	"LinuxOnM/internal/utils/dedup"
+	"LinuxOnM/internal/utils/files"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Deduplicated directory backups keep one chunk repository per cronjob and account below
+// directory/<cronjob name>/dedup, every run writes a snapshot index into its snapshots dir
+// and the backup record points at that index.
+func loadDedupRepoDir(cronjob models.Cronjob) string {
+	return path.Join("directory", cronjob.Name, "dedup")
+}
+
+func openDedupRepo(item cronjobUploadHelper, repoDir, cronjobKey string) (*dedup.Repository, error) {
+	return dedup.Open(item.client, path.Join(item.backupPath, repoDir), path.Join(global.CONF.System.TmpDir, "dedup"), item.loadEncryptKey(cronjobKey))
+}
+
+func (u *CronjobService) handleDedupDirectory(ctx context.Context, cronjob models.Cronjob, startTime time.Time, taskLog *cronjobTaskLog) ([]byte, error) {
+	accountMap, err := loadClientMap(cronjob.BackupAccounts)
+	if err != nil {
+		return nil, err
+	}
+	repoDir := loadDedupRepoDir(cronjob)
+	record := models.BackupRecord{
+		From:       "cronjob",
+		CronjobID:  cronjob.ID,
+		Type:       cronjob.Type,
+		Name:       cronjob.Name,
+		Source:     cronjob.SourceDir,
+		BackupType: constant.BackupModeDedup,
+		FileDir:    path.Join(repoDir, "snapshots"),
+		FileName:   fmt.Sprintf("directory_%s_%s", path.Base(cronjob.SourceDir), startTime.Format(constant.DateTimeSlimLayout)),
+	}
+	parent := loadDedupParent(cronjob)
+	var exclude dedup.ExcludeFunc
+	if rules := files.NewIgnoreRules(cronjob.ExclusionRules); !rules.Empty() {
+		exclude = rules.Match
+	}
+	cronjobKey := loadCronjobEncryptKey(cronjob)
+
+	var (
+		messages []string
+		written  []cronjobUploadHelper
+	)
+	// snapshots written before a failure have no record, they are removed so their chunks can be pruned
+	handleErr := func(err error) ([]byte, error) {
+		for _, item := range written {
+			_, _ = item.client.Delete(path.Join(item.backupPath, record.FileDir, record.FileName))
+		}
+		return []byte(strings.Join(messages, "\n")), err
+	}
+	for _, account := range strings.Split(cronjob.BackupAccounts, ",") {
+		if len(account) == 0 {
+			continue
+		}
+		item, ok := accountMap[account]
+		if !ok {
+			return handleErr(fmt.Errorf("load backup account %s failed", account))
+		}
+		repo, err := openDedupRepo(item, repoDir, cronjobKey)
+		if err != nil {
+			return handleErr(fmt.Errorf("open dedup repository on %s failed, err: %v", account, err))
+		}
+		taskLog.Printf("back up %s to the dedup repository on %s", cronjob.SourceDir, account)
+		stats, err := repo.Backup(ctx, cronjob.SourceDir, record.FileName, parent, exclude)
+		repo.Close()
+		if err != nil {
+			return handleErr(fmt.Errorf("backup %s to %s failed, err: %v", cronjob.SourceDir, account, err))
+		}
+		written = append(written, item)
+		// the record keeps the size of the source, every account walks it again so it can differ
+		// when files change during the run, the sizes per account are kept in the log
+		if len(written) == 1 {
+			record.Size = stats.Size
+		}
+		messages = append(messages, fmt.Sprintf("%s: %d files (%d bytes), %d of %d chunks are new, %d bytes uploaded",
+			account, stats.Files, stats.Size, stats.NewChunks, stats.Chunks, stats.UploadSize))
+		if stats.Size != record.Size {
+			messages = append(messages, fmt.Sprintf("%s: the source changed during the backup, %d bytes were backed up to the first account", account, record.Size))
+		}
+	}
+	if err := backupRepo.CreateRecord(&record); err != nil {
+		return handleErr(err)
+	}
+	u.removeExpiredBackup(cronjob, accountMap, record)
+	return []byte(strings.Join(messages, "\n")), nil
+}
+
+// loadDedupParent returns the snapshot of the last run, unchanged files are taken from it without reading them
+func loadDedupParent(cronjob models.Cronjob) string {
+	records, _ := backupRepo.ListRecord(backupRepo.WithByCronID(cronjob.ID), commonRepo.WithOrderBy("created_at desc"))
+	for _, record := range records {
+		if record.BackupType == constant.BackupModeDedup {
+			return record.FileName
+		}
+	}
+	return ""
+}
+
+// pruneDedupRepos removes the chunks which are no longer referenced after expired snapshots were deleted
+func pruneDedupRepos(cronjob models.Cronjob, accountMap map[string]cronjobUploadHelper) {
+	cronjobKey := loadCronjobEncryptKey(cronjob)
+	for _, account := range strings.Split(cronjob.BackupAccounts, ",") {
+		item, ok := accountMap[account]
+		if !ok {
+			continue
+		}
+		repo, err := openDedupRepo(item, loadDedupRepoDir(cronjob), cronjobKey)
+		if err != nil {
+			global.LOG.Errorf("open dedup repository of cronjob %s on %s failed, err: %v", cronjob.Name, account, err)
+			continue
+		}
+		removed, err := repo.Prune()
+		repo.Close()
+		if err != nil {
+			global.LOG.Errorf("prune dedup repository of cronjob %s on %s failed, err: %v", cronjob.Name, account, err)
+			continue
+		}
+		global.LOG.Infof("prune dedup repository of cronjob %s on %s successful, %d chunks removed", cronjob.Name, account, removed)
+	}
+}
+
+// restoreDedupRecord restores the snapshot of the record into targetDir from the first account holding it
+func restoreDedupRecord(record models.BackupRecord, reqAccount, targetDir string, files []string) error {
+	cronjob, _ := cronjobRepo.Get(commonRepo.WithByID(record.CronjobID))
+	cronjobKey := loadCronjobEncryptKey(cronjob)
+	for _, account := range loadRecordAccounts(record, reqAccount) {
+		accountMap, err := loadClientMap(account)
+		if err != nil {
+			global.LOG.Errorf("load backup account %s failed, err: %v", account, err)
+			continue
+		}
+		item, ok := accountMap[account]
+		if !ok {
+			continue
+		}
+		if exist, _ := item.client.Exist(path.Join(item.backupPath, record.FileDir, record.FileName)); !exist {
+			continue
+		}
+		repo, err := openDedupRepo(item, path.Dir(record.FileDir), cronjobKey)
+		if err != nil {
+			return err
+		}
+		err = repo.Restore(record.FileName, targetDir, files)
+		repo.Close()
+		return err
+	}
+	return buserr.WithName(constant.ErrBackupFileMissing, record.FileName)
+}
+
+// downloadDedupRecord restores the snapshot into the tmp dir and packs it as a tar.gz archive for downloading
+func downloadDedupRecord(record models.BackupRecord, account string) (string, error) {
+	tmpDir := path.Join(global.CONF.System.TmpDir, "download", record.FileDir, fmt.Sprintf("%s_%s", record.FileName, common.RandStrAndNum(5)))
+	if err := os.MkdirAll(tmpDir, os.ModePerm); err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := restoreDedupRecord(record, account, tmpDir, nil); err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		return "", err
+	}
+	var sourcePaths []string
+	for _, entry := range entries {
+		sourcePaths = append(sourcePaths, path.Join(tmpDir, entry.Name()))
+	}
+	if len(sourcePaths) == 0 {
+		return "", buserr.WithName(constant.ErrBackupFileMissing, record.FileName)
+	}
+	targetPath := loadDownloadPath(record.FileName + ".tar.gz")
+	if err := os.MkdirAll(path.Dir(targetPath), os.ModePerm); err != nil {
+		return "", err
+	}
+	if err := files.NewTarGzArchiver().Compress(sourcePaths, targetPath, ""); err != nil {
+		_ = os.RemoveAll(path.Dir(targetPath))
+		return "", err
+	}
+	return targetPath, nil
+}
+
+// checkDedupRecord verifies that the chunks of the snapshot exist, the full mode also checks their content
+func checkDedupRecord(ctx context.Context, item cronjobUploadHelper, record models.BackupRecord, mode, cronjobKey string) error {
+	repo, err := openDedupRepo(item, path.Dir(record.FileDir), cronjobKey)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+	return repo.Check(ctx, record.FileName, mode == "full")
+}
+
+func (u *BackupService) ListRecordFiles(req dto.OperateByID) ([]dto.RecordFile, error) {
+	record, _ := backupRepo.GetRecord(commonRepo.WithByID(req.ID))
+	if record.ID == 0 {
+		return nil, constant.ErrRecordNotFound
+	}
+	if record.BackupType != constant.BackupModeDedup {
+		return nil, buserr.WithName(constant.ErrBackupRecoverType, record.BackupType)
+	}
+	cronjob, _ := cronjobRepo.Get(commonRepo.WithByID(record.CronjobID))
+	cronjobKey := loadCronjobEncryptKey(cronjob)
+	for _, account := range loadRecordAccounts(record, "") {
+		accountMap, err := loadClientMap(account)
+		if err != nil {
+			continue
+		}
+		item, ok := accountMap[account]
+		if !ok {
+			continue
+		}
+		if exist, _ := item.client.Exist(path.Join(item.backupPath, record.FileDir, record.FileName)); !exist {
+			continue
+		}
+		repo, err := openDedupRepo(item, path.Dir(record.FileDir), cronjobKey)
+		if err != nil {
+			return nil, err
+		}
+		snap, err := repo.LoadSnapshot(record.FileName)
+		repo.Close()
+		if err != nil {
+			return nil, buserr.WithDetail(constant.ErrBackupCorrupted, err.Error(), err)
+		}
+		datas := make([]dto.RecordFile, 0, len(snap.Files))
+		for _, file := range snap.Files {
+			datas = append(datas, dto.RecordFile{Path: file.Path, Type: file.Type, Size: file.Size, ModTime: file.ModTime})
+		}
+		return datas, nil
+	}
+	return nil, buserr.WithName(constant.ErrBackupFileMissing, record.FileName)
+}
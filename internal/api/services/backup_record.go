@@ -0,0 +1,244 @@
+package services
+
+import (
+	"LinuxOnM/internal/api/dto"
+	"LinuxOnM/internal/buserr"
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/global"
+	"LinuxOnM/internal/models"
+	"LinuxOnM/internal/repositories"
+	"LinuxOnM/internal/utils/cmd"
+	"LinuxOnM/internal/utils/common"
+	"LinuxOnM/internal/utils/copier"
+	"LinuxOnM/internal/utils/files"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func (u *BackupService) SearchRecordsWithPage(search dto.RecordSearch) (int64, []dto.BackupRecords, error) {
+	var opts []repositories.DBOption
+	if len(search.From) != 0 {
+		opts = append(opts, commonRepo.WithByFrom(search.From))
+	}
+	if search.CronjobID != 0 {
+		opts = append(opts, backupRepo.WithByCronID(search.CronjobID))
+	}
+	if len(search.Name) != 0 {
+		opts = append(opts, commonRepo.WithByName(search.Name))
+	}
+	opts = append(opts, backupRepo.WithByType(search.Type), backupRepo.WithByDetailName(search.DetailName))
+	total, records, err := backupRepo.PageRecord(search.Page, search.PageSize, opts...)
+	if err != nil {
+		return 0, nil, err
+	}
+	var datas []dto.BackupRecords
+	for _, record := range records {
+		var item dto.BackupRecords
+		if err := copier.Copy(&item, &record); err != nil {
+			return 0, nil, errors.WithMessage(constant.ErrStructTransform, err.Error())
+		}
+		item.Accounts = loadRecordAccounts(record, "")
+		datas = append(datas, item)
+	}
+	return total, datas, nil
+}
+
+// DownloadRecord fetches the backup file into a tmp dir of its own and returns the local path, the
+// caller removes that dir. The accounts are tried one by one until one of them holds the file.
+func (u *BackupService) DownloadRecord(req dto.DownloadRecord) (string, error) {
+	record, _ := backupRepo.GetRecord(commonRepo.WithByID(req.ID))
+	if record.ID == 0 {
+		return "", constant.ErrRecordNotFound
+	}
+	if record.BackupType == constant.BackupModeDedup {
+		return downloadDedupRecord(record, req.Account)
+	}
+	targetPath := loadDownloadPath(record.FileName)
+	cronjob, _ := cronjobRepo.Get(commonRepo.WithByID(record.CronjobID))
+	cronjobKey := loadCronjobEncryptKey(cronjob)
+	for _, account := range loadRecordAccounts(record, req.Account) {
+		// clients are created one by one so that an unreachable account does not block the others
+		accountMap, err := loadClientMap(account)
+		if err != nil {
+			global.LOG.Errorf("load backup account %s failed, err: %v", account, err)
+			continue
+		}
+		item, ok := accountMap[account]
+		if !ok {
+			continue
+		}
+		srcPath := path.Join(item.backupPath, record.FileDir, record.FileName)
+		if exist, _ := item.client.Exist(srcPath); !exist {
+			continue
+		}
+		if err := item.download(context.Background(), srcPath, targetPath, cronjobKey); err != nil {
+			var busErr buserr.BusinessError
+			if errors.As(err, &busErr) {
+				// the file is there but can not be decrypted, trying other accounts would hide the reason
+				_ = os.RemoveAll(path.Dir(targetPath))
+				return "", err
+			}
+			global.LOG.Errorf("download backup file %s from %s failed, err: %v", srcPath, account, err)
+			continue
+		}
+		return targetPath, nil
+	}
+	_ = os.RemoveAll(path.Dir(targetPath))
+	return "", buserr.WithName(constant.ErrBackupFileMissing, record.FileName)
+}
+
+func (u *BackupService) RecoverRecord(req dto.RecordRecover) error {
+	record, _ := backupRepo.GetRecord(commonRepo.WithByID(req.ID))
+	if record.ID == 0 {
+		return constant.ErrRecordNotFound
+	}
+	if record.Type != "directory" {
+		return buserr.WithName(constant.ErrBackupRecoverType, record.Type)
+	}
+	targetDir := path.Clean(req.TargetDir)
+	if !path.IsAbs(targetDir) || (targetDir == "/" && req.Mode == "overwrite") {
+		return constant.ErrInvalidParams
+	}
+	// single files can only be picked from deduplicated backups and never replace the whole target
+	if len(req.Files) != 0 && (record.BackupType != constant.BackupModeDedup || req.Mode == "overwrite") {
+		return constant.ErrInvalidParams
+	}
+	secret := req.Secret
+	if len(secret) == 0 && record.CronjobID != 0 {
+		cronjob, _ := cronjobRepo.Get(commonRepo.WithByID(record.CronjobID))
+		secret = cronjob.Secret
+	}
+
+	tmpDir := path.Join(global.CONF.System.TmpDir, "recover", fmt.Sprintf("%s_%s", time.Now().Format(constant.DateTimeSlimLayout), common.RandStrAndNum(5)))
+	if err := os.MkdirAll(tmpDir, os.ModePerm); err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	if record.BackupType == constant.BackupModeDedup {
+		if err := restoreDedupRecord(record, "", tmpDir, req.Files); err != nil {
+			return err
+		}
+	} else {
+		filePath, err := u.DownloadRecord(dto.DownloadRecord{ID: record.ID})
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(path.Dir(filePath))
+		if err := files.NewTarGzArchiver().Extract(filePath, tmpDir, secret); err != nil {
+			return err
+		}
+	}
+	srcDir, err := loadRecoverRoot(tmpDir)
+	if err != nil {
+		return err
+	}
+
+	if req.Mode == "overwrite" {
+		if err := replaceRecoverDir(srcDir, targetDir); err != nil {
+			return fmt.Errorf("recover %s to %s failed, err: %v", record.FileName, targetDir, err)
+		}
+	} else {
+		if err := os.MkdirAll(targetDir, os.ModePerm); err != nil {
+			return err
+		}
+		if _, err := cmd.ExecWithCheck("cp", "-a", srcDir+"/.", targetDir+"/"); err != nil {
+			return fmt.Errorf("recover %s to %s failed, err: %v", record.FileName, targetDir, err)
+		}
+	}
+	global.LOG.Infof("recover backup %s to %s (%s) successful", record.FileName, targetDir, req.Mode)
+	return nil
+}
+
+// loadRecordAccounts orders the candidate accounts of a record: the requested one,
+// the cronjob default download account and then the rest of the cronjob accounts.
+// Records whose cronjob was deleted fall back to every configured account.
+func loadRecordAccounts(record models.BackupRecord, account string) []string {
+	candidates := []string{account}
+	cronjob, _ := cronjobRepo.Get(commonRepo.WithByID(record.CronjobID))
+	if cronjob.ID != 0 {
+		candidates = append(candidates, cronjob.DefaultDownload)
+		candidates = append(candidates, strings.Split(cronjob.BackupAccounts, ",")...)
+	} else {
+		candidates = append(candidates, constant.Local)
+		backups, _ := backupRepo.List()
+		for _, backup := range backups {
+			candidates = append(candidates, backup.Type)
+		}
+	}
+	var accounts []string
+	for _, item := range candidates {
+		if len(item) == 0 || slices.Contains(accounts, item) {
+			continue
+		}
+		accounts = append(accounts, item)
+	}
+	return accounts
+}
+
+// replaceRecoverDir copies the recovered files into a staging dir next to the target and swaps it in
+// with renames, the target is left untouched until the copy is complete and is put back when the
+// swap fails. The staging dir takes over the mode and the owner of the target.
+func replaceRecoverDir(srcDir, targetDir string) error {
+	suffix := fmt.Sprintf("%s_%s", time.Now().Format(constant.DateTimeSlimLayout), common.RandStrAndNum(5))
+	stagingDir := fmt.Sprintf("%s.recover_%s", targetDir, suffix)
+	oldDir := fmt.Sprintf("%s.old_%s", targetDir, suffix)
+	if err := os.MkdirAll(stagingDir, os.ModePerm); err != nil {
+		return err
+	}
+	if _, err := cmd.ExecWithCheck("cp", "-a", srcDir+"/.", stagingDir+"/"); err != nil {
+		_ = os.RemoveAll(stagingDir)
+		return err
+	}
+	info, err := os.Stat(targetDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			_ = os.RemoveAll(stagingDir)
+			return err
+		}
+		return os.Rename(stagingDir, targetDir)
+	}
+	_ = os.Chmod(stagingDir, info.Mode().Perm())
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		_ = os.Chown(stagingDir, int(stat.Uid), int(stat.Gid))
+	}
+	if err := os.Rename(targetDir, oldDir); err != nil {
+		_ = os.RemoveAll(stagingDir)
+		return err
+	}
+	if err := os.Rename(stagingDir, targetDir); err != nil {
+		_ = os.Rename(oldDir, targetDir)
+		_ = os.RemoveAll(stagingDir)
+		return err
+	}
+	if err := os.RemoveAll(oldDir); err != nil {
+		global.LOG.Errorf("remove the replaced dir %s failed, err: %v", oldDir, err)
+	}
+	return nil
+}
+
+// loadDownloadPath returns a tmp path for a downloaded file, every download gets a dir of its own so that
+// concurrent downloads of the same record do not write into each other while the file keeps its name
+func loadDownloadPath(fileName string) string {
+	return path.Join(global.CONF.System.TmpDir, "download", common.RandStrAndNum(10), fileName)
+}
+
+// loadRecoverRoot returns the top level directory of an extracted directory backup,
+// archives are created from the source dir so they hold a single entry named after it
+func loadRecoverRoot(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		return path.Join(dir, entries[0].Name()), nil
+	}
+	return dir, nil
+}
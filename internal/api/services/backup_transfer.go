@@ -0,0 +1,110 @@
+package services
+
+import (
+	"LinuxOnM/internal/buserr"
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/global"
+	"LinuxOnM/internal/utils/common"
+	"LinuxOnM/internal/utils/storage_client"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Running transfers are kept in memory so they can be cancelled, their progress is
+// written to the cache under the transfer key where the websocket "transfer" type reads it.
+var backupTransfers = struct {
+	sync.Mutex
+	items map[string]*backupTransfer
+}{items: make(map[string]*backupTransfer)}
+
+type backupTransfer struct {
+	process storage_client.TransferProcess
+	cancel  context.CancelFunc
+}
+
+func (u *BackupService) ListTransfers() []storage_client.TransferProcess {
+	backupTransfers.Lock()
+	defer backupTransfers.Unlock()
+	datas := make([]storage_client.TransferProcess, 0, len(backupTransfers.items))
+	for _, item := range backupTransfers.items {
+		datas = append(datas, item.process)
+	}
+	sort.Slice(datas, func(i, j int) bool {
+		return datas[i].Key < datas[j].Key
+	})
+	return datas
+}
+
+func (u *BackupService) CancelTransfer(key string) error {
+	backupTransfers.Lock()
+	defer backupTransfers.Unlock()
+	item, ok := backupTransfers.items[key]
+	if !ok {
+		return buserr.WithName(constant.ErrTransferNotFound, key)
+	}
+	item.cancel()
+	return nil
+}
+
+// runTransfer registers a cancellable transfer and runs it, the progress is saved at most twice a second.
+// The transfer also ends when the parent context is done, e.g. when the cronjob running it is stopped.
+func runTransfer(parent context.Context, transferType, account, name string, handle func(ctx context.Context, progress storage_client.ProgressFunc) error) error {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	key := fmt.Sprintf("transfer-%s-%s", time.Now().Format(constant.DateTimeSlimLayout), common.RandStrAndNum(6))
+	transfer := &backupTransfer{
+		process: storage_client.TransferProcess{Key: key, Type: transferType, Account: account, Name: name, Status: constant.StatusRunning},
+		cancel:  cancel,
+	}
+	backupTransfers.Lock()
+	backupTransfers.items[key] = transfer
+	backupTransfers.Unlock()
+	saveTransferProcess(transfer.process)
+
+	var lastSave time.Time
+	err := handle(ctx, func(transferred, total int64) {
+		backupTransfers.Lock()
+		transfer.process.Transferred = transferred
+		transfer.process.Total = total
+		if total > 0 {
+			transfer.process.Percent = math.Round(float64(transferred)/float64(total)*10000) / 100
+		}
+		process := transfer.process
+		backupTransfers.Unlock()
+		if time.Since(lastSave) > 500*time.Millisecond || transferred == total {
+			lastSave = time.Now()
+			saveTransferProcess(process)
+		}
+	})
+
+	backupTransfers.Lock()
+	delete(backupTransfers.items, key)
+	switch {
+	case err == nil:
+		transfer.process.Status = constant.StatusSuccess
+	case ctx.Err() != nil:
+		// clients wrap the error of the cancelled reader, the context tells the reason reliably
+		transfer.process.Status = constant.StatusCancelled
+		transfer.process.Message = "the transfer was cancelled"
+		err = buserr.WithName(constant.ErrTransferCancelled, name)
+	default:
+		transfer.process.Status = constant.StatusFailed
+		transfer.process.Message = err.Error()
+	}
+	process := transfer.process
+	backupTransfers.Unlock()
+	saveTransferProcess(process)
+	return err
+}
+
+func saveTransferProcess(process storage_client.TransferProcess) {
+	value, _ := json.Marshal(process)
+	if err := global.CACHE.SetWithTTL(process.Key, string(value), time.Hour); err != nil {
+		global.LOG.Errorf("save progress of transfer %s failed, err: %v", process.Key, err)
+	}
+}
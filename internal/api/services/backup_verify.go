@@ -0,0 +1,150 @@
+package services
+
+import (
+	"LinuxOnM/internal/api/dto"
+	"LinuxOnM/internal/buserr"
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/global"
+	"LinuxOnM/internal/models"
+	"LinuxOnM/internal/utils/common"
+	"LinuxOnM/internal/utils/encrypt"
+	"LinuxOnM/internal/utils/files"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+func (u *BackupService) VerifyRecord(req dto.RecordVerify) error {
+	record, _ := backupRepo.GetRecord(commonRepo.WithByID(req.ID))
+	if record.ID == 0 {
+		return constant.ErrRecordNotFound
+	}
+	return verifyRecord(context.Background(), record, req.Mode)
+}
+
+// verifyRecord checks the copies of the record on its accounts and saves the result on the record.
+// The stat mode only compares the object size, the full mode downloads the object, recomputes the
+// checksum and test-extracts the archive. Failures are sent to the notification api, nothing is
+// saved when ctx is done before all copies were checked.
+func verifyRecord(ctx context.Context, record models.BackupRecord, mode string) error {
+	cronjob, _ := cronjobRepo.Get(commonRepo.WithByID(record.CronjobID))
+	cronjobKey := loadCronjobEncryptKey(cronjob)
+	expectAccounts := strings.Split(cronjob.BackupAccounts, ",")
+
+	var failures []string
+	checked := 0
+	for _, account := range loadRecordAccounts(record, "") {
+		accountMap, err := loadClientMap(account)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", account, err))
+			continue
+		}
+		item, ok := accountMap[account]
+		if !ok {
+			continue
+		}
+		srcPath := path.Join(item.backupPath, record.FileDir, record.FileName)
+		if exist, _ := item.client.Exist(srcPath); !exist {
+			// records of deleted cronjobs are looked up on every account, only the expected ones must hold the file
+			if slices.Contains(expectAccounts, account) {
+				failures = append(failures, fmt.Sprintf("%s: file is missing", account))
+			}
+			continue
+		}
+		checked++
+		if err := verifyRecordCopy(ctx, item, record, srcPath, mode, cronjob.Secret, cronjobKey); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", account, err))
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if checked == 0 && len(failures) == 0 {
+		failures = append(failures, "no backup account holds the file")
+	}
+
+	record.VerifiedAt = time.Now()
+	record.VerifyStatus = constant.RecordVerified
+	record.VerifyMessage = strings.Join(failures, "; ")
+	if len(failures) != 0 {
+		record.VerifyStatus = constant.RecordCorrupt
+	}
+	if err := backupRepo.UpdateRecord(&record); err != nil {
+		return err
+	}
+	if len(failures) != 0 {
+		global.LOG.Errorf("verify backup %s failed, err: %s", record.FileName, record.VerifyMessage)
+		NewNotificationService().SendBackupAlert(record.FileName, record.VerifyMessage)
+		return buserr.WithDetail(constant.ErrBackupVerify, record.VerifyMessage, nil)
+	}
+	global.LOG.Infof("verify backup %s (%s) successful", record.FileName, mode)
+	return nil
+}
+
+func verifyRecordCopy(ctx context.Context, item cronjobUploadHelper, record models.BackupRecord, srcPath, mode, secret, cronjobKey string) error {
+	if record.BackupType == constant.BackupModeDedup {
+		return checkDedupRecord(ctx, item, record, mode, cronjobKey)
+	}
+	if mode != "full" {
+		if record.Size == 0 {
+			return nil
+		}
+		size, err := item.client.Size(srcPath)
+		if err != nil {
+			return err
+		}
+		if size != record.Size && size != encrypt.EncryptedSize(record.Size) {
+			return fmt.Errorf("size %d does not match the manifest size %d", size, record.Size)
+		}
+		return nil
+	}
+
+	verifyDir := path.Join(global.CONF.System.TmpDir, "verify", fmt.Sprintf("%s_%s", time.Now().Format(constant.DateTimeSlimLayout), common.RandStrAndNum(5)))
+	if err := os.MkdirAll(verifyDir, os.ModePerm); err != nil {
+		return err
+	}
+	defer os.RemoveAll(verifyDir)
+	filePath := path.Join(verifyDir, record.FileName)
+	if err := item.download(ctx, srcPath, filePath, cronjobKey); err != nil {
+		return err
+	}
+	checksum, size, err := loadFileManifest(filePath)
+	if err != nil {
+		return err
+	}
+	if len(record.Checksum) != 0 && (checksum != record.Checksum || size != record.Size) {
+		return fmt.Errorf("checksum %s does not match the manifest checksum %s", checksum, record.Checksum)
+	}
+	if strings.HasSuffix(record.FileName, ".tar.gz") {
+		extractDir := path.Join(verifyDir, "extract")
+		if err := os.MkdirAll(extractDir, os.ModePerm); err != nil {
+			return err
+		}
+		if err := files.NewTarGzArchiver().Extract(filePath, extractDir, secret); err != nil {
+			return fmt.Errorf("test extract failed, err: %v", err)
+		}
+	}
+	return nil
+}
+
+// loadFileManifest returns the sha256 checksum and the size of the file
+func loadFileManifest(filePath string) (string, int64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
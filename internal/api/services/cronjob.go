@@ -8,6 +8,7 @@ import (
 	"LinuxOnM/internal/utils/copier"
 	"bufio"
 	"fmt"
+	"github.com/gorilla/websocket"
 	"github.com/pkg/errors"
 	"github.com/robfig/cron/v3"
 	"os"
@@ -29,7 +30,15 @@ type ICronjobService interface {
 	StartJob(cronjob *models.Cronjob, isUpdate bool) (string, error)
 	SearchRecords(search dto.SearchRecord) (int64, interface{}, error)
 	LoadRecordLog(req dto.OperateByID) string
+	LoadHostRecordLog(req dto.OperateByID) string
 	CleanRecord(req dto.CronjobClean) error
+	StopExecution(recordID uint) error
+	TailRecordLog(wsConn *websocket.Conn, recordID uint, tail int, follow bool) error
+	SearchWorkflowRuns(req dto.SearchWorkflowRun) (int64, interface{}, error)
+	Export(req dto.CronjobExport) ([]byte, error)
+	Import(req dto.CronjobImport) (dto.CronjobImportResult, error)
+	PreviewRetention(req dto.RetentionPreview) (dto.RetentionPreviewResult, error)
+	PreviewSpec(req dto.CronjobSpecPreview) (dto.CronjobSpecResult, error)
 }
 
 func NewICronjobService() ICronjobService {
@@ -45,7 +54,35 @@ func (u *CronjobService) Create(cronjobDto dto.CronjobCreate) error {
 	if err := copier.Copy(&cronjob, &cronjobDto); err != nil {
 		return errors.WithMessage(constant.ErrStructTransform, err.Error())
 	}
+	if err := checkCronSpec(cronjob.Spec); err != nil {
+		return err
+	}
+	if cronjob.Type == "curl" {
+		if err := checkHttpParams(cronjob); err != nil {
+			return err
+		}
+	}
+	if err := checkRetryExitCodes(cronjob.Type, cronjob.RetryExitCodes); err != nil {
+		return err
+	}
+	if cronjob.Type == "shell" {
+		if err := checkShellParams(cronjob); err != nil {
+			return err
+		}
+	}
+	triggers, err := loadTriggerModels(cronjob, cronjobDto.Triggers)
+	if err != nil {
+		return err
+	}
+	cronjob.Environment, err = loadEnvironment(models.Cronjob{}, cronjobDto.Envs)
+	if err != nil {
+		return err
+	}
 	cronjob.Status = constant.StatusEnable
+	cronjob.EncryptKey, err = encryptBackupKey(cronjobDto.EncryptKey)
+	if err != nil {
+		return err
+	}
 
 	global.LOG.Infof("create cronjob %s successful, spec: %s", cronjob.Name, cronjob.Spec)
 	spec := cronjob.Spec
@@ -58,7 +95,10 @@ func (u *CronjobService) Create(cronjobDto dto.CronjobCreate) error {
 	if err := cronjobRepo.Create(&cronjob); err != nil {
 		return err
 	}
-	return nil
+	for i := range triggers {
+		triggers[i].CronjobID = cronjob.ID
+	}
+	return cronjobRepo.SaveTriggers(cronjob.ID, triggers)
 }
 
 func (u *CronjobService) Delete(req dto.CronjobBatchDelete) error {
@@ -76,6 +116,8 @@ func (u *CronjobService) Delete(req dto.CronjobBatchDelete) error {
 		if err := u.CleanRecord(dto.CronjobClean{CronjobID: id, CleanData: req.CleanData, IsDelete: true}); err != nil {
 			return err
 		}
+		_ = cronjobRepo.DeleteTriggers(cronjobRepo.WithByJobID(int(id)))
+		_ = cronjobRepo.DeleteTriggers(cronjobRepo.WithByTargetID(id))
 		if err := cronjobRepo.Delete(commonRepo.WithByID(id)); err != nil {
 			return err
 		}
@@ -128,7 +170,8 @@ func mkdirAndWriteFile(cronjob *models.Cronjob, startTime time.Time, msg []byte)
 
 	path := fmt.Sprintf("%s/%s.log", dir, startTime.Format(constant.DateTimeSlimLayout))
 	global.LOG.Infof("cronjob %s has generated some logs %s", cronjob.Name, path)
-	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0666)
+	// the message is appended to the progress the backup jobs wrote while they ran
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
 	if err != nil {
 		return "", err
 	}
@@ -147,12 +190,21 @@ func (u *CronjobService) SearchWithPage(search dto.PageCronjob) (int64, interfac
 		if err := copier.Copy(&item, &cronjob); err != nil {
 			return 0, nil, errors.WithMessage(constant.ErrStructTransform, err.Error())
 		}
+		item.HasEncryptKey = len(cronjob.EncryptKey) != 0
+		item.Triggers = loadTriggers(cronjob.ID)
+		item.Envs = loadEnvs(cronjob)
 		record, _ := cronjobRepo.RecordFirst(cronjob.ID)
 		if record.ID != 0 {
 			item.LastRecordTime = record.StartTime.Format(constant.DateTimeLayout)
 		} else {
 			item.LastRecordTime = "-"
 		}
+		item.NextRunTime = "-"
+		if cronjob.Status == constant.StatusEnable {
+			if next := loadNextRunTime(cronjob.Spec); !next.IsZero() {
+				item.NextRunTime = next.In(loadCronLocation()).Format(constant.DateTimeLayout)
+			}
+		}
 		dtoCronjobs = append(dtoCronjobs, item)
 	}
 	return total, dtoCronjobs, err
@@ -168,8 +220,42 @@ func (u *CronjobService) Update(id uint, req dto.CronjobUpdate) error {
 		return constant.ErrRecordNotFound
 	}
 	upMap := make(map[string]interface{})
+	// the stored passphrase is kept when none is sent, it is never returned to the client,
+	// clearEncryptKey blanks it so that the next backups are written unencrypted
+	cronjob.EncryptKey = cronModel.EncryptKey
+	if req.ClearEncryptKey {
+		cronjob.EncryptKey = ""
+	} else if len(req.EncryptKey) != 0 {
+		if cronjob.EncryptKey, err = encryptBackupKey(req.EncryptKey); err != nil {
+			return err
+		}
+	}
 	cronjob.EntryIDs = cronModel.EntryIDs
 	cronjob.Type = cronModel.Type
+	if err := checkCronSpec(cronjob.Spec); err != nil {
+		return err
+	}
+	if cronjob.Type == "curl" {
+		if err := checkHttpParams(cronjob); err != nil {
+			return err
+		}
+	}
+	if err := checkRetryExitCodes(cronjob.Type, req.RetryExitCodes); err != nil {
+		return err
+	}
+	if cronjob.Type == "shell" {
+		if err := checkShellParams(cronjob); err != nil {
+			return err
+		}
+	}
+	triggers, err := loadTriggerModels(cronModel, req.Triggers)
+	if err != nil {
+		return err
+	}
+	cronjob.Environment, err = loadEnvironment(cronModel, req.Envs)
+	if err != nil {
+		return err
+	}
 	spec := cronjob.Spec
 	if cronModel.Status == constant.StatusEnable {
 		newEntryIDs, err := u.StartJob(&cronjob, true)
@@ -187,17 +273,52 @@ func (u *CronjobService) Update(id uint, req dto.CronjobUpdate) error {
 
 	upMap["name"] = req.Name
 	upMap["spec"] = spec
+	upMap["timeout"] = req.Timeout
+	upMap["concurrency_policy"] = req.ConcurrencyPolicy
+	upMap["retry_max_attempts"] = req.RetryMaxAttempts
+	upMap["retry_backoff"] = req.RetryBackoff
+	upMap["retry_delay"] = req.RetryDelay
+	upMap["retry_exit_codes"] = req.RetryExitCodes
+	upMap["notify_policy"] = req.NotifyPolicy
+	upMap["notify_on_failure"] = req.NotifyOnFailure
+	upMap["notify_on_success"] = req.NotifyOnSuccess
+	upMap["notify_over_duration"] = req.NotifyOverDuration
 	upMap["script"] = req.Script
 	upMap["command"] = req.Command
 	upMap["container_name"] = req.ContainerName
 	upMap["exclusion_rules"] = req.ExclusionRules
 	upMap["url"] = req.URL
 	upMap["source_dir"] = req.SourceDir
+	upMap["run_as_user"] = req.RunAsUser
+	upMap["run_as_group"] = req.RunAsGroup
+	upMap["workdir"] = req.Workdir
+	upMap["interpreter"] = req.Interpreter
+	upMap["environment"] = cronjob.Environment
+	upMap["host_ids"] = req.HostIDs
+	upMap["host_group_id"] = req.HostGroupID
 
 	upMap["backup_accounts"] = req.BackupAccounts
 	upMap["default_download"] = req.DefaultDownload
 	upMap["retain_copies"] = req.RetainCopies
+	upMap["retain_daily"] = req.RetainDaily
+	upMap["retain_weekly"] = req.RetainWeekly
+	upMap["retain_monthly"] = req.RetainMonthly
+	upMap["retain_yearly"] = req.RetainYearly
+	upMap["retain_min_age"] = req.RetainMinAge
 	upMap["secret"] = req.Secret
+	upMap["encrypt_key"] = cronjob.EncryptKey
+	upMap["backup_mode"] = req.BackupMode
+	upMap["log_clean_mode"] = req.LogCleanMode
+	upMap["log_containers"] = req.LogContainers
+	upMap["http_method"] = req.HttpMethod
+	upMap["http_headers"] = req.HttpHeaders
+	upMap["http_body"] = req.HttpBody
+	upMap["http_timeout"] = req.HttpTimeout
+	upMap["expect_status"] = req.ExpectStatus
+	upMap["expect_body"] = req.ExpectBody
+	if err := cronjobRepo.SaveTriggers(id, triggers); err != nil {
+		return err
+	}
 	return cronjobRepo.Update(id, upMap)
 }
 
@@ -249,6 +370,7 @@ func (u *CronjobService) SearchRecords(search dto.SearchRecord) (int64, interfac
 			return 0, nil, errors.WithMessage(constant.ErrStructTransform, err.Error())
 		}
 		item.StartTime = record.StartTime.Format(constant.DateTimeLayout)
+		item.Hosts = loadHostResults(record.ID)
 		dtoCronjobs = append(dtoCronjobs, item)
 	}
 	return total, dtoCronjobs, err
@@ -281,6 +403,8 @@ func (u *CronjobService) CleanRecord(req dto.CronjobClean) error {
 				return err
 			}
 			cronjob.RetainCopies = 0
+			cronjob.RetainDaily, cronjob.RetainWeekly, cronjob.RetainMonthly, cronjob.RetainYearly = 0, 0, 0, 0
+			cronjob.RetainMinAge = 0
 			u.removeExpiredBackup(cronjob, accountMap, models.BackupRecord{})
 		} else {
 			u.removeExpiredLog(cronjob)
@@ -298,10 +422,11 @@ func (u *CronjobService) CleanRecord(req dto.CronjobClean) error {
 		return err
 	}
 	for _, del := range delRecords {
+		removeHostRecords(del)
 		_ = os.RemoveAll(del.Records)
 	}
 	if err := cronjobRepo.DeleteRecord(cronjobRepo.WithByJobID(int(req.CronjobID))); err != nil {
 		return err
 	}
-	return nil
+	return cronjobRepo.DeleteWorkflowRun(cronjobRepo.WithByJobID(int(req.CronjobID)))
 }
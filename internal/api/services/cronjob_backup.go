@@ -0,0 +1,298 @@
+package services
+
+import (
+	"LinuxOnM/internal/api/dto"
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/global"
+	"LinuxOnM/internal/models"
+	"LinuxOnM/internal/utils/common"
+	"LinuxOnM/internal/utils/docker"
+	"LinuxOnM/internal/utils/files"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// handleDirectory archives the source dir into a tar.gz file and uploads it to every backup
+// account of the cronjob, the deduplicated mode is handled by handleDedupDirectory
+func (u *CronjobService) handleDirectory(ctx context.Context, cronjob models.Cronjob, startTime time.Time, taskLog *cronjobTaskLog) error {
+	if _, err := os.Stat(cronjob.SourceDir); err != nil {
+		return fmt.Errorf("load source dir %s failed, err: %v", cronjob.SourceDir, err)
+	}
+	accountMap, err := loadClientMap(cronjob.BackupAccounts)
+	if err != nil {
+		return err
+	}
+	record := models.BackupRecord{
+		From:       "cronjob",
+		CronjobID:  cronjob.ID,
+		Type:       cronjob.Type,
+		Name:       cronjob.Name,
+		Source:     cronjob.SourceDir,
+		BackupType: constant.BackupModeArchive,
+		FileDir:    path.Join("directory", cronjob.Name),
+		FileName:   fmt.Sprintf("directory_%s_%s.tar.gz", path.Base(cronjob.SourceDir), startTime.Format(constant.DateTimeSlimLayout)),
+	}
+
+	tmpDir := path.Join(global.CONF.System.TmpDir, "directory", fmt.Sprintf("%s_%s", startTime.Format(constant.DateTimeSlimLayout), common.RandStrAndNum(5)))
+	if err := os.MkdirAll(tmpDir, os.ModePerm); err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	filePath := path.Join(tmpDir, record.FileName)
+	var exclude func(relPath string, isDir bool) bool
+	if rules := files.NewIgnoreRules(cronjob.ExclusionRules); !rules.Empty() {
+		exclude = rules.Match
+	}
+	taskLog.Printf("compress %s into %s", cronjob.SourceDir, record.FileName)
+	if err := (files.TarGzArchiver{}).CompressDir(ctx, cronjob.SourceDir, filePath, cronjob.Secret, exclude); err != nil {
+		return fmt.Errorf("compress %s failed, err: %v", cronjob.SourceDir, err)
+	}
+
+	if err := u.uploadRecordFile(ctx, cronjob, accountMap, filePath, &record, taskLog); err != nil {
+		return err
+	}
+	if err := backupRepo.CreateRecord(&record); err != nil {
+		return err
+	}
+	taskLog.Printf("backup %s saved, remove the expired backups", record.FileName)
+	u.removeExpiredBackup(cronjob, accountMap, record)
+	return nil
+}
+
+// handleSnapshot takes a system snapshot to the backup accounts of the cronjob, the record
+// points at the snapshot archive so that expired snapshots are removed with their records
+func (u *CronjobService) handleSnapshot(ctx context.Context, cronjob models.Cronjob, startTime time.Time, taskLog *cronjobTaskLog) error {
+	accountMap, err := loadClientMap(cronjob.BackupAccounts)
+	if err != nil {
+		return err
+	}
+	snap, err := newSnapshot(dto.SnapshotCreate{
+		From:            cronjob.BackupAccounts,
+		DefaultDownload: cronjob.DefaultDownload,
+		Description:     fmt.Sprintf("cronjob %s", cronjob.Name),
+	}, startTime)
+	if err != nil {
+		return err
+	}
+	taskLog.Printf("take snapshot %s", snap.Name)
+	file, err := handleSnapshot(ctx, snap, loadCronjobEncryptKey(cronjob), taskLog)
+	if err != nil {
+		return err
+	}
+	record := models.BackupRecord{
+		From:       "cronjob",
+		CronjobID:  cronjob.ID,
+		Type:       cronjob.Type,
+		Name:       cronjob.Name,
+		Source:     snap.Name,
+		BackupType: constant.BackupModeArchive,
+		FileDir:    snapshotDir,
+		FileName:   snap.Name + ".tar.gz",
+		Checksum:   file.checksum,
+		Size:       file.size,
+	}
+	if err := backupRepo.CreateRecord(&record); err != nil {
+		return err
+	}
+	taskLog.Printf("snapshot %s saved, remove the expired snapshots", snap.Name)
+	u.removeExpiredBackup(cronjob, accountMap, record)
+	return nil
+}
+
+// handleLog archives the panel logs, the cronjob task logs and optionally the container logs, the
+// originals are kept, truncated or deleted after the upload according to the clean mode of the job
+func (u *CronjobService) handleLog(ctx context.Context, cronjob models.Cronjob, startTime time.Time, taskLog *cronjobTaskLog) ([]byte, error) {
+	accountMap, err := loadClientMap(cronjob.BackupAccounts)
+	if err != nil {
+		return nil, err
+	}
+	record := models.BackupRecord{
+		From:       "cronjob",
+		CronjobID:  cronjob.ID,
+		Type:       cronjob.Type,
+		Name:       cronjob.Name,
+		BackupType: constant.BackupModeArchive,
+		FileDir:    "log",
+		FileName:   fmt.Sprintf("log_%s.tar.gz", startTime.Format(constant.DateTimeSlimLayout)),
+	}
+	tmpDir := path.Join(global.CONF.System.TmpDir, "log", fmt.Sprintf("%s_%s", startTime.Format(constant.DateTimeSlimLayout), common.RandStrAndNum(5)))
+	defer os.RemoveAll(tmpDir)
+	stageDir := path.Join(tmpDir, strings.TrimSuffix(record.FileName, ".tar.gz"))
+
+	var messages []string
+	logFiles := make(map[string][]string)
+	logFiles["panel"] = loadLogFiles(global.CONF.System.LogPath)
+	logFiles["task"] = loadLogFiles(path.Join(constant.DataDir, "task"))
+	if cronjob.LogContainers {
+		containerLogs, err := loadContainerLogFiles()
+		if err != nil {
+			messages = append(messages, fmt.Sprintf("load container logs failed, err: %v", err))
+		}
+		logFiles["container"] = containerLogs
+	}
+	taskLog.Printf("copy %d panel, %d task and %d container log files", len(logFiles["panel"]), len(logFiles["task"]), len(logFiles["container"]))
+	count := 0
+	for dir, items := range logFiles {
+		for _, item := range items {
+			if ctx.Err() != nil {
+				return []byte(strings.Join(messages, "\n")), ctx.Err()
+			}
+			target := path.Join(stageDir, dir, strings.TrimPrefix(item, "/"))
+			if err := os.MkdirAll(path.Dir(target), os.ModePerm); err != nil {
+				return nil, err
+			}
+			if err := common.CopyFile(item, target); err != nil {
+				messages = append(messages, fmt.Sprintf("copy %s failed, err: %v", item, err))
+				continue
+			}
+			count++
+		}
+	}
+	filePath := path.Join(tmpDir, record.FileName)
+	taskLog.Printf("compress %d log files into %s", count, record.FileName)
+	if err := (files.TarGzArchiver{}).CompressDir(ctx, stageDir, filePath, cronjob.Secret, nil); err != nil {
+		return []byte(strings.Join(messages, "\n")), fmt.Errorf("compress logs failed, err: %v", err)
+	}
+	if err := u.uploadRecordFile(ctx, cronjob, accountMap, filePath, &record, taskLog); err != nil {
+		return []byte(strings.Join(messages, "\n")), err
+	}
+	if err := backupRepo.CreateRecord(&record); err != nil {
+		return []byte(strings.Join(messages, "\n")), err
+	}
+	messages = append(messages, fmt.Sprintf("%d log files archived to %s (%s)", count, record.FileName, common.FormatBytes(uint64(record.Size))))
+	u.removeExpiredBackup(cronjob, accountMap, record)
+
+	if cronjob.LogCleanMode == constant.LogCleanTruncate || cronjob.LogCleanMode == constant.LogCleanDelete {
+		taskLog.Printf("%s the archived log files", cronjob.LogCleanMode)
+		usage := loadTaskLogUsage()
+		cleaned, kept := 0, 0
+		for dir, items := range logFiles {
+			for _, item := range items {
+				if dir == "task" && !usage.canClean(item, cronjob.LogCleanMode) {
+					kept++
+					continue
+				}
+				if err := cleanLogFile(item, cronjob.LogCleanMode); err != nil {
+					messages = append(messages, fmt.Sprintf("%s %s failed, err: %v", cronjob.LogCleanMode, item, err))
+					continue
+				}
+				cleaned++
+			}
+		}
+		messages = append(messages, fmt.Sprintf("%d log files cleaned (%s)", cleaned, cronjob.LogCleanMode))
+		if kept != 0 {
+			messages = append(messages, fmt.Sprintf("%d task logs kept as they belong to running jobs or records refer to them", kept))
+		}
+	}
+	return []byte(strings.Join(messages, "\n")), nil
+}
+
+type taskLogUsage struct {
+	live       map[string]bool
+	liveDirs   []string
+	referenced map[string]bool
+}
+
+// loadTaskLogUsage collects the task logs of the running records, which are still written to, and the
+// ones the records and the host records refer to
+func loadTaskLogUsage() taskLogUsage {
+	usage := taskLogUsage{live: make(map[string]bool), referenced: make(map[string]bool)}
+	records, _ := cronjobRepo.ListRecord()
+	for _, record := range records {
+		if len(record.Records) == 0 {
+			continue
+		}
+		usage.referenced[record.Records] = true
+		if record.Status == constant.StatusWaiting {
+			usage.live[record.Records] = true
+			// the logs of the remote hosts are written next to the log of the record
+			usage.liveDirs = append(usage.liveDirs, strings.TrimSuffix(record.Records, ".log")+"/")
+		}
+	}
+	hostRecords, _ := cronjobRepo.ListHostRecords()
+	for _, record := range hostRecords {
+		if len(record.Records) == 0 {
+			continue
+		}
+		usage.referenced[record.Records] = true
+		if record.Status == constant.StatusWaiting {
+			usage.live[record.Records] = true
+		}
+	}
+	return usage
+}
+
+// canClean reports whether the task log may be cleaned, logs of running jobs are never touched and
+// the logs records refer to are only truncated, they are deleted together with their records
+func (t taskLogUsage) canClean(filePath, mode string) bool {
+	if t.live[filePath] {
+		return false
+	}
+	for _, dir := range t.liveDirs {
+		if strings.HasPrefix(filePath, dir) {
+			return false
+		}
+	}
+	return mode != constant.LogCleanDelete || !t.referenced[filePath]
+}
+
+// loadLogFiles returns the regular files below dir, a missing dir has no logs
+func loadLogFiles(dir string) []string {
+	var logFiles []string
+	_ = filepath.WalkDir(dir, func(itemPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.Type().IsRegular() {
+			logFiles = append(logFiles, itemPath)
+		}
+		return nil
+	})
+	return logFiles
+}
+
+// loadContainerLogFiles returns the json log files of all containers and their rotated copies
+func loadContainerLogFiles() ([]string, error) {
+	client, err := docker.NewDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	ctx := context.Background()
+	containers, err := client.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	var logFiles []string
+	for _, item := range containers {
+		containerItem, err := client.ContainerInspect(ctx, item.ID)
+		if err != nil || len(containerItem.LogPath) == 0 {
+			continue
+		}
+		if _, err := os.Stat(containerItem.LogPath); err != nil {
+			continue
+		}
+		logFiles = append(logFiles, containerItem.LogPath)
+		rotated, _ := filepath.Glob(fmt.Sprintf("%s.*", containerItem.LogPath))
+		logFiles = append(logFiles, rotated...)
+	}
+	return logFiles, nil
+}
+
+// cleanLogFile truncates or deletes the log file, files which are still written to (the current
+// panel log and the container logs) are always truncated
+func cleanLogFile(filePath, mode string) error {
+	currentLog := path.Join(global.CONF.System.LogPath, global.CONF.LogConfig.LogName+global.CONF.LogConfig.LogSuffix)
+	if mode == constant.LogCleanDelete && filePath != currentLog && !strings.HasSuffix(filePath, "-json.log") {
+		return os.Remove(filePath)
+	}
+	return os.Truncate(filePath, 0)
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/global"
+	"LinuxOnM/internal/models"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const cronjobQueuePollInterval = time.Second
+
+// A run of a cronjob overlaps the records of the job which are still waiting, that is running,
+// waiting for a retry or queued. The check and the creation of the record are done under the lock
+// so that two runs starting at once do not both see the job idle.
+var concurrencyLock sync.Mutex
+
+func loadRunningRecords(cronjobID uint) []models.JobRecords {
+	records, _ := cronjobRepo.ListRecord(cronjobRepo.WithByJobID(int(cronjobID)), commonRepo.WithByStatus(constant.StatusWaiting), commonRepo.WithOrderBy("id asc"))
+	return records
+}
+
+// skipRecord records a run which was skipped because the job was still running, a workflow run
+// started by it is ended right away
+func skipRecord(cronjob models.Cronjob, running models.JobRecords, runID, triggeredBy uint) {
+	record := cronjobRepo.StartRecords(cronjob.ID, cronjob.KeepLocal, "")
+	_ = cronjobRepo.UpdateRecords(record.ID, map[string]interface{}{"attempt": 1, "workflow_run_id": runID, "triggered_by": triggeredBy})
+	cronjobRepo.EndRecords(record, constant.StatusSkipped, fmt.Sprintf("skipped as record %d is still running", running.ID), "")
+	global.LOG.Infof("cronjob %s is still running, skip this run", cronjob.Name)
+	if runID != 0 && triggeredBy == 0 {
+		endWorkflowRun(runID)
+	}
+}
+
+// replaceRecords stops the running executions of the job, the records which wait for a retry or
+// in the queue are cancelled before they start
+func replaceRecords(cronjob models.Cronjob, records []models.JobRecords, recordID uint) {
+	for _, item := range records {
+		cronjobExecutions.Lock()
+		cancel, ok := cronjobExecutions.items[item.ID]
+		cronjobExecutions.Unlock()
+		if ok {
+			cancel()
+			continue
+		}
+		cronjobRepo.EndRecords(item, constant.StatusCancelled, fmt.Sprintf("replaced by record %d", recordID), item.Records)
+		if item.WorkflowRunID != 0 {
+			endWorkflowRun(item.WorkflowRunID)
+		}
+	}
+	global.LOG.Infof("cronjob %s is still running, replace it with record %d", cronjob.Name, recordID)
+}
+
+// queueRecord starts the record once the records started before it ended, a retry belongs to the
+// record it retries. The record is dropped when it does not wait any more as it was replaced.
+func (u *CronjobService) queueRecord(cronjob *models.Cronjob, record models.JobRecords) {
+	ticker := time.NewTicker(cronjobQueuePollInterval)
+	defer ticker.Stop()
+	for {
+		current, _ := cronjobRepo.GetRecord(commonRepo.WithByID(record.ID))
+		if current.Status != constant.StatusWaiting {
+			return
+		}
+		if !hasEarlierRecord(loadRunningRecords(cronjob.ID), record.ID) {
+			break
+		}
+		<-ticker.C
+	}
+	record.StartTime = time.Now()
+	_ = cronjobRepo.UpdateRecords(record.ID, map[string]interface{}{"start_time": record.StartTime, "message": ""})
+	u.runRecord(cronjob, record)
+}
+
+func hasEarlierRecord(records []models.JobRecords, recordID uint) bool {
+	for _, item := range records {
+		if item.ID < recordID || (item.RetryOf != 0 && item.RetryOf < recordID) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"LinuxOnM/internal/buserr"
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const cronjobDefaultTimeout = 24 * time.Hour
+
+// Running executions are kept by record id so that they can be stopped from the panel.
+var cronjobExecutions = struct {
+	sync.Mutex
+	items map[uint]context.CancelFunc
+}{items: make(map[uint]context.CancelFunc)}
+
+// startExecution registers the execution of the record, the context is done when the timeout
+// of the cronjob is reached or the execution is stopped, finish must be called when it ends
+func startExecution(cronjob models.Cronjob, recordID uint) (ctx context.Context, finish func()) {
+	ctx, cancel := context.WithTimeout(context.Background(), loadCronjobTimeout(cronjob))
+	cronjobExecutions.Lock()
+	cronjobExecutions.items[recordID] = cancel
+	cronjobExecutions.Unlock()
+	return ctx, func() {
+		cronjobExecutions.Lock()
+		delete(cronjobExecutions.items, recordID)
+		cronjobExecutions.Unlock()
+		cancel()
+	}
+}
+
+func (u *CronjobService) StopExecution(recordID uint) error {
+	cronjobExecutions.Lock()
+	defer cronjobExecutions.Unlock()
+	cancel, ok := cronjobExecutions.items[recordID]
+	if !ok {
+		return buserr.WithName(constant.ErrCronjobNotRunning, strconv.Itoa(int(recordID)))
+	}
+	cancel()
+	return nil
+}
+
+func loadCronjobTimeout(cronjob models.Cronjob) time.Duration {
+	if cronjob.Timeout == 0 {
+		return cronjobDefaultTimeout
+	}
+	return time.Duration(cronjob.Timeout) * time.Second
+}
+
+// loadExecutionStatus tells a timed out or stopped execution from a failed one, it has to be
+// called before the execution is finished
+func loadExecutionStatus(ctx context.Context, cronjob models.Cronjob, err error) (string, string) {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return constant.StatusTimeout, fmt.Sprintf("the task timed out after %s", loadCronjobTimeout(cronjob))
+	case errors.Is(ctx.Err(), context.Canceled):
+		return constant.StatusCancelled, "the task was stopped"
+	default:
+		return constant.StatusFailed, err.Error()
+	}
+}
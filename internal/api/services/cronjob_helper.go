@@ -5,61 +5,140 @@ import (
 	"LinuxOnM/internal/global"
 	"LinuxOnM/internal/models"
 	"LinuxOnM/internal/repositories"
-	"LinuxOnM/internal/utils/cmd"
+	"LinuxOnM/internal/utils/common"
+	"LinuxOnM/internal/utils/encrypt"
 	"LinuxOnM/internal/utils/ntp"
 	"LinuxOnM/internal/utils/storage_client"
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
+	"slices"
 	"strings"
 	"time"
 )
 
 func (u *CronjobService) HandleJob(cronjob *models.Cronjob) {
+	u.handleJob(cronjob, startWorkflowRun(*cronjob), 0)
+}
+
+// handleJob runs the cronjob in the background, jobs of a workflow run are recorded in the run
+// together with the record which triggered them. A job which is still running is run anyway,
+// skipped, queued or replaced according to its concurrency policy.
+func (u *CronjobService) handleJob(cronjob *models.Cronjob, runID, triggeredBy uint) {
+	concurrencyLock.Lock()
+	defer concurrencyLock.Unlock()
+	running := loadRunningRecords(cronjob.ID)
+	if len(running) != 0 && cronjob.ConcurrencyPolicy == constant.ConcurrencySkip {
+		skipRecord(*cronjob, running[0], runID, triggeredBy)
+		return
+	}
+	record := cronjobRepo.StartRecords(cronjob.ID, cronjob.KeepLocal, "")
+	record.Attempt, record.WorkflowRunID, record.TriggeredBy = 1, runID, triggeredBy
+	_ = cronjobRepo.UpdateRecords(record.ID, map[string]interface{}{"attempt": 1, "workflow_run_id": runID, "triggered_by": triggeredBy})
+	switch {
+	case len(running) == 0:
+		go u.runRecord(cronjob, record)
+	case cronjob.ConcurrencyPolicy == constant.ConcurrencyQueue:
+		_ = cronjobRepo.UpdateRecords(record.ID, map[string]interface{}{"message": fmt.Sprintf("queued after record %d", running[len(running)-1].ID)})
+		go u.queueRecord(cronjob, record)
+	case cronjob.ConcurrencyPolicy == constant.ConcurrencyReplace:
+		replaceRecords(*cronjob, running, record.ID)
+		go u.queueRecord(cronjob, record)
+	default:
+		go u.runRecord(cronjob, record)
+	}
+}
+
+// runRecord runs one attempt of the cronjob, the downstream jobs are triggered once the
+// last attempt ended
+func (u *CronjobService) runRecord(cronjob *models.Cronjob, record models.JobRecords) {
 	var (
 		message []byte
 		err     error
 	)
-	record := cronjobRepo.StartRecords(cronjob.ID, cronjob.KeepLocal, "")
-	go func() {
-		switch cronjob.Type {
-		case "shell":
-			if len(cronjob.Script) == 0 {
-				return
-			}
-			record.Records = u.generateLogsPath(*cronjob, record.StartTime)
-			_ = cronjobRepo.UpdateRecords(record.ID, map[string]interface{}{"records": record.Records})
-			script := cronjob.Script
-			if len(cronjob.ContainerName) != 0 {
-				command := "sh"
-				if len(cronjob.Command) != 0 {
-					command = cronjob.Command
-				}
-				script = fmt.Sprintf("docker exec %s %s -c \"%s\"", cronjob.ContainerName, command, strings.ReplaceAll(cronjob.Script, "\"", "\\\""))
-			}
-			err = u.handleShell(cronjob.Type, cronjob.Name, script, record.Records)
-			u.removeExpiredLog(*cronjob)
-		case "ntp":
-			err = u.handleNtpSync()
-			u.removeExpiredLog(*cronjob)
+	ctx, finish := startExecution(*cronjob, record.ID)
+	defer finish()
+	switch cronjob.Type {
+	case "shell":
+		if len(cronjob.Script) == 0 {
+			err = errors.New("the script of the cronjob is empty")
+			break
 		}
-
-		if err != nil {
-			if len(message) != 0 {
-				record.Records, _ = mkdirAndWriteFile(cronjob, record.StartTime, message)
-			}
-			cronjobRepo.EndRecords(record, constant.StatusFailed, err.Error(), record.Records)
-			return
+		record.Records = u.generateLogsPath(*cronjob, record.StartTime)
+		_ = cronjobRepo.UpdateRecords(record.ID, map[string]interface{}{"records": record.Records})
+		if hasRemoteHosts(*cronjob) {
+			err = u.handleRemoteShell(ctx, *cronjob, record)
+		} else {
+			err = u.handleShell(ctx, *cronjob, record.Records)
+		}
+		u.removeExpiredLog(*cronjob)
+	case "ntp":
+		err = u.handleNtpSync(ctx)
+		u.removeExpiredLog(*cronjob)
+	case "directory":
+		taskLog := u.startTaskLog(*cronjob, &record)
+		if cronjob.BackupMode == constant.BackupModeDedup {
+			message, err = u.handleDedupDirectory(ctx, *cronjob, record.StartTime, taskLog)
+		} else {
+			err = u.handleDirectory(ctx, *cronjob, record.StartTime, taskLog)
 		}
+		taskLog.Close()
+		u.removeExpiredLog(*cronjob)
+	case "snapshot":
+		taskLog := u.startTaskLog(*cronjob, &record)
+		err = u.handleSnapshot(ctx, *cronjob, record.StartTime, taskLog)
+		taskLog.Close()
+		u.removeExpiredLog(*cronjob)
+	case "log":
+		taskLog := u.startTaskLog(*cronjob, &record)
+		message, err = u.handleLog(ctx, *cronjob, record.StartTime, taskLog)
+		taskLog.Close()
+		u.removeExpiredLog(*cronjob)
+	case "curl":
+		message, err = u.handleHttp(ctx, *cronjob, record.ID)
+		u.removeExpiredLog(*cronjob)
+	case "verify":
+		message, err = u.handleVerify(ctx, *cronjob)
+		u.removeExpiredLog(*cronjob)
+	}
+
+	status, errMsg, execErr := constant.StatusSuccess, "", err
+	if err != nil {
 		if len(message) != 0 {
-			record.Records, err = mkdirAndWriteFile(cronjob, record.StartTime, message)
-			if err != nil {
-				global.LOG.Errorf("save file %s failed, err: %v", record.Records, err)
-			}
+			record.Records, _ = mkdirAndWriteFile(cronjob, record.StartTime, message)
+		}
+		status, errMsg = loadExecutionStatus(ctx, *cronjob, err)
+	} else if len(message) != 0 {
+		record.Records, err = mkdirAndWriteFile(cronjob, record.StartTime, message)
+		if err != nil {
+			global.LOG.Errorf("save file %s failed, err: %v", record.Records, err)
 		}
-		cronjobRepo.EndRecords(record, constant.StatusSuccess, "", record.Records)
-	}()
+	}
+	// the retry is created before the record ends so that a queued run does not start in between
+	retried := u.retryRecord(cronjob, record, status, execErr)
+	cronjobRepo.EndRecords(record, status, errMsg, record.Records)
+	if retried {
+		return
+	}
+	notifyRecord(*cronjob, record, status, errMsg, execErr)
+	u.handleTriggers(*cronjob, record, status)
+}
+
+// startTaskLog sets the log of the record before a backup job runs so that its progress can be
+// followed, the job runs without writing its progress when the log can not be opened
+func (u *CronjobService) startTaskLog(cronjob models.Cronjob, record *models.JobRecords) *cronjobTaskLog {
+	record.Records = u.generateLogsPath(cronjob, record.StartTime)
+	_ = cronjobRepo.UpdateRecords(record.ID, map[string]interface{}{"records": record.Records})
+	taskLog, err := openCronjobTaskLog(record.Records)
+	if err != nil {
+		global.LOG.Errorf("open log %s of cronjob %s failed, err: %v", record.Records, cronjob.Name, err)
+		return nil
+	}
+	return taskLog
 }
 
 func (u *CronjobService) generateLogsPath(cronjob models.Cronjob, startTime time.Time) string {
@@ -72,31 +151,27 @@ func (u *CronjobService) generateLogsPath(cronjob models.Cronjob, startTime time
 	return path
 }
 
-func (u *CronjobService) handleShell(cronType, cornName, script, logPath string) error {
-	handleDir := fmt.Sprintf("%s/task/%s/%s", constant.DataDir, cronType, cornName)
-	if _, err := os.Stat(handleDir); err != nil && os.IsNotExist(err) {
-		if err = os.MkdirAll(handleDir, os.ModePerm); err != nil {
-			return err
-		}
-	}
-	if err := cmd.ExecCronjobWithTimeOut(script, handleDir, logPath, 24*time.Hour); err != nil {
-		return err
-	}
-	return nil
-}
-
 func (u *CronjobService) removeExpiredLog(cronjob models.Cronjob) {
 	records, _ := cronjobRepo.ListRecord(cronjobRepo.WithByJobID(int(cronjob.ID)), commonRepo.WithOrderBy("created_at desc"))
 	if len(records) <= int(cronjob.RetainCopies) {
 		return
 	}
-	for i := int(cronjob.RetainCopies); i < len(records); i++ {
+	times := make([]time.Time, 0, len(records))
+	for _, record := range records {
+		times = append(times, record.StartTime)
+	}
+	for i, reasons := range loadRetentionPolicy(cronjob).apply(times, time.Now()) {
+		// records which are still running are kept, their logs are written to
+		if len(reasons) != 0 || records[i].Status == constant.StatusWaiting {
+			continue
+		}
 		if len(records[i].File) != 0 {
 			files := strings.Split(records[i].File, ",")
 			for _, file := range files {
 				_ = os.Remove(file)
 			}
 		}
+		removeHostRecords(records[i])
 		_ = cronjobRepo.DeleteRecord(commonRepo.WithByID(uint(records[i].ID)))
 		_ = os.Remove(records[i].Records)
 	}
@@ -123,14 +198,15 @@ func loadClientMap(backupAccounts string) (map[string]cronjobUploadHelper, error
 				if err != nil {
 					return nil, err
 				}
-				pathItem := account.BackupPath
-				if account.BackupPath != "/" {
-					pathItem = strings.TrimPrefix(account.BackupPath, "/")
+				encryptKey, err := encrypt.StringDecrypt(account.EncryptKey)
+				if err != nil {
+					return nil, err
 				}
 				clients[target] = cronjobUploadHelper{
 					client:     client,
-					backupPath: pathItem,
+					backupPath: loadBackupPath(account),
 					backType:   account.Type,
+					encryptKey: encryptKey,
 				}
 			}
 		}
@@ -152,15 +228,28 @@ func (u *CronjobService) removeExpiredBackup(cronjob models.Cronjob, accountMap
 	if len(records) <= int(cronjob.RetainCopies) {
 		return
 	}
-	for i := int(cronjob.RetainCopies); i < len(records); i++ {
+	times := make([]time.Time, 0, len(records))
+	for _, item := range records {
+		times = append(times, item.CreatedAt)
+	}
+	hasDedup := false
+	for i, reasons := range loadRetentionPolicy(cronjob).apply(times, time.Now()) {
+		if len(reasons) != 0 {
+			continue
+		}
 		accounts := strings.Split(cronjob.BackupAccounts, ",")
+		hasDedup = hasDedup || records[i].BackupType == constant.BackupModeDedup
 		if cronjob.Type == "snapshot" {
 			for _, account := range accounts {
 				if len(account) != 0 {
-					_, _ = accountMap[account].client.Delete(path.Join(accountMap[account].backupPath, "system_snapshot", records[i].FileName))
+					_, _ = accountMap[account].client.Delete(path.Join(accountMap[account].backupPath, snapshotDir, records[i].FileName))
 				}
 			}
-			_ = snapshotRepo.Delete(commonRepo.WithByName(strings.TrimSuffix(records[i].FileName, ".tar.gz")))
+			snap, _ := snapshotRepo.Get(commonRepo.WithByName(strings.TrimSuffix(records[i].FileName, ".tar.gz")))
+			if snap.ID != 0 {
+				_ = snapshotRepo.DeleteStatus(snap.ID)
+				_ = snapshotRepo.Delete(commonRepo.WithByID(snap.ID))
+			}
 		} else {
 			for _, account := range accounts {
 				if len(account) != 0 {
@@ -170,9 +259,13 @@ func (u *CronjobService) removeExpiredBackup(cronjob models.Cronjob, accountMap
 		}
 		_ = backupRepo.DeleteRecord(context.Background(), commonRepo.WithByID(records[i].ID))
 	}
+	if hasDedup {
+		pruneDedupRepos(cronjob, accountMap)
+	}
 }
 
-func (u *CronjobService) handleNtpSync() error {
+// handleNtpSync reads the time of the ntp server, the system time is not set any more once ctx is done
+func (u *CronjobService) handleNtpSync(ctx context.Context) error {
 	ntpServer, err := settingRepo.Get(settingRepo.WithByKey("NtpSite"))
 	if err != nil {
 		return err
@@ -181,6 +274,9 @@ func (u *CronjobService) handleNtpSync() error {
 	if err != nil {
 		return err
 	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	if err := ntp.UpdateSystemTime(ntime.Format(constant.DateTimeLayout)); err != nil {
 		return err
 	}
@@ -191,4 +287,161 @@ type cronjobUploadHelper struct {
 	backupPath string
 	backType   string
 	client     storage_client.StorageClient
+	encryptKey string
+}
+
+// loadEncryptKey returns the passphrase used for the account, the one of the cronjob takes precedence
+func (h cronjobUploadHelper) loadEncryptKey(cronjobKey string) string {
+	if len(cronjobKey) != 0 {
+		return cronjobKey
+	}
+	return h.encryptKey
+}
+
+// upload streams the archive to the account, it is encrypted on the fly when a passphrase is set.
+// The progress is also written to the task log of the cronjob running the upload.
+func (h cronjobUploadHelper) upload(ctx context.Context, src, target, cronjobKey string, taskLog *cronjobTaskLog) error {
+	encryptKey := h.loadEncryptKey(cronjobKey)
+	return runTransfer(ctx, "upload", h.backType, target, func(ctx context.Context, progress storage_client.ProgressFunc) error {
+		progress = taskLog.transferProgress(fmt.Sprintf("upload %s to %s", path.Base(target), h.backType), progress)
+		if len(encryptKey) == 0 {
+			_, err := storage_client.UploadWithProgress(ctx, h.client, src, target, progress)
+			return err
+		}
+		file, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			_ = file.Close()
+			return err
+		}
+		pipeReader, pipeWriter := io.Pipe()
+		defer pipeReader.Close()
+		go func() {
+			defer file.Close()
+			_ = pipeWriter.CloseWithError(encrypt.EncryptStream(file, pipeWriter, encryptKey))
+		}()
+		_, err = storage_client.UploadStreamWithProgress(ctx, h.client, pipeReader, encrypt.EncryptedSize(info.Size()), target, progress)
+		return err
+	})
+}
+
+// download streams the file from the account into target and decrypts it on the fly when it was uploaded encrypted
+func (h cronjobUploadHelper) download(ctx context.Context, src, target, cronjobKey string) error {
+	return runTransfer(ctx, "download", h.backType, src, func(ctx context.Context, progress storage_client.ProgressFunc) error {
+		if err := os.MkdirAll(path.Dir(target), os.ModePerm); err != nil {
+			return err
+		}
+		file, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		pipeReader, pipeWriter := io.Pipe()
+		defer pipeReader.Close()
+		go func() {
+			_, err := storage_client.DownloadStreamWithProgress(ctx, h.client, src, pipeWriter, progress)
+			_ = pipeWriter.CloseWithError(err)
+		}()
+		reader := bufio.NewReader(pipeReader)
+		if encrypt.IsEncryptedReader(reader) {
+			err = encrypt.DecryptStream(reader, file, h.loadEncryptKey(cronjobKey))
+		} else {
+			_, err = io.Copy(file, reader)
+		}
+		if err != nil {
+			_ = file.Close()
+			_ = os.Remove(target)
+		}
+		return err
+	})
+}
+
+// uploadRecordFile sends the local archive to every backup account of the cronjob, the checksum and
+// size of the archive are kept on the record so that later verifications can compare against them
+func (u *CronjobService) uploadRecordFile(ctx context.Context, cronjob models.Cronjob, accountMap map[string]cronjobUploadHelper, src string, record *models.BackupRecord, taskLog *cronjobTaskLog) error {
+	checksum, size, err := loadFileManifest(src)
+	if err != nil {
+		return err
+	}
+	record.Checksum = checksum
+	record.Size = size
+	cronjobKey := loadCronjobEncryptKey(cronjob)
+	for _, account := range strings.Split(cronjob.BackupAccounts, ",") {
+		if len(account) == 0 {
+			continue
+		}
+		item, ok := accountMap[account]
+		if !ok {
+			return fmt.Errorf("load backup account %s failed", account)
+		}
+		taskLog.Printf("upload %s (%s) to %s", record.FileName, common.FormatBytes(uint64(size)), account)
+		if err := item.upload(ctx, src, path.Join(item.backupPath, record.FileDir, record.FileName), cronjobKey, taskLog); err != nil {
+			return fmt.Errorf("upload %s to %s failed, err: %v", record.FileName, account, err)
+		}
+	}
+	return nil
+}
+
+// handleVerify stats every backup record kept on the accounts of the cronjob (all accounts when none
+// is selected) and fully verifies the latest record of each backup, failed records are marked corrupt
+func (u *CronjobService) handleVerify(ctx context.Context, cronjob models.Cronjob) ([]byte, error) {
+	records, err := backupRepo.ListRecord(commonRepo.WithOrderBy("created_at desc"))
+	if err != nil {
+		return nil, err
+	}
+	var (
+		messages []string
+		failed   int
+		checked  int
+	)
+	latest := make(map[string]bool)
+	for _, record := range records {
+		if len(cronjob.BackupAccounts) != 0 && !hasCommonAccount(cronjob.BackupAccounts, loadRecordAccounts(record, "")) {
+			continue
+		}
+		mode := "stat"
+		key := fmt.Sprintf("%d/%s/%s/%s", record.CronjobID, record.Type, record.Name, record.DetailName)
+		if !latest[key] {
+			latest[key] = true
+			mode = "full"
+		}
+		checked++
+		if err := verifyRecord(ctx, record, mode); err != nil {
+			if ctx.Err() != nil {
+				return []byte(strings.Join(messages, "\n")), ctx.Err()
+			}
+			failed++
+			messages = append(messages, fmt.Sprintf("[%s] %s (%s): %v", constant.RecordCorrupt, record.FileName, mode, err))
+			continue
+		}
+		messages = append(messages, fmt.Sprintf("[%s] %s (%s)", constant.RecordVerified, record.FileName, mode))
+	}
+	message := []byte(strings.Join(messages, "\n"))
+	if failed != 0 {
+		return message, fmt.Errorf("%d of %d backup records failed verification", failed, checked)
+	}
+	return message, nil
+}
+
+func hasCommonAccount(backupAccounts string, accounts []string) bool {
+	for _, account := range strings.Split(backupAccounts, ",") {
+		if len(account) != 0 && slices.Contains(accounts, account) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadCronjobEncryptKey decrypts the passphrase stored on the cronjob
+func loadCronjobEncryptKey(cronjob models.Cronjob) string {
+	encryptKey, err := encrypt.StringDecrypt(cronjob.EncryptKey)
+	if err != nil {
+		global.LOG.Errorf("decrypt encrypt key of cronjob %s failed, err: %v", cronjob.Name, err)
+		return ""
+	}
+	return encryptKey
 }
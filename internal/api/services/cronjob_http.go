@@ -0,0 +1,165 @@
+package services
+
+import (
+	"LinuxOnM/internal/buserr"
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/models"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	httpDefaultTimeout = 30 * time.Second
+	httpBodyLimit      = 1 << 20
+	httpExcerptSize    = 512
+)
+
+// checkHttpParams validates the request and the expectations of a curl cronjob before it is saved
+func checkHttpParams(cronjob models.Cronjob) error {
+	target, err := url.Parse(cronjob.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || len(target.Host) == 0 {
+		return buserr.WithDetail(constant.ErrCronjobHttpParams, fmt.Sprintf("url %s", cronjob.URL), err)
+	}
+	if _, err := loadHttpHeaders(cronjob.HttpHeaders); err != nil {
+		return buserr.WithDetail(constant.ErrCronjobHttpParams, err.Error(), err)
+	}
+	if _, err := matchExpectStatus(cronjob.ExpectStatus, http.StatusOK); err != nil {
+		return buserr.WithDetail(constant.ErrCronjobHttpParams, err.Error(), err)
+	}
+	if _, err := regexp.Compile(cronjob.ExpectBody); err != nil {
+		return buserr.WithDetail(constant.ErrCronjobHttpParams, fmt.Sprintf("expect body %s", cronjob.ExpectBody), err)
+	}
+	return nil
+}
+
+// handleHttp sends the request of the cronjob and saves the status code, the latency and an
+// excerpt of the response on the record, the run fails when the expectations are not met
+func (u *CronjobService) handleHttp(ctx context.Context, cronjob models.Cronjob, recordID uint) ([]byte, error) {
+	method := cronjob.HttpMethod
+	if len(method) == 0 {
+		method = http.MethodGet
+	}
+	timeout := httpDefaultTimeout
+	if cronjob.HttpTimeout != 0 {
+		timeout = time.Duration(cronjob.HttpTimeout) * time.Second
+	}
+	headers, err := loadHttpHeaders(cronjob.HttpHeaders)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, cronjob.URL, strings.NewReader(cronjob.HttpBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = headers
+	if host := headers.Get("Host"); len(host) != 0 {
+		req.Host = host
+	}
+
+	startTime := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		latency := float64(time.Since(startTime).Milliseconds())
+		_ = cronjobRepo.UpdateRecords(recordID, map[string]interface{}{"latency": latency})
+		return []byte(fmt.Sprintf("%s %s\nlatency: %vms", method, cronjob.URL, latency)), err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, httpBodyLimit))
+	latency := float64(time.Since(startTime).Milliseconds())
+	excerpt := loadHttpExcerpt(body)
+	_ = cronjobRepo.UpdateRecords(recordID, map[string]interface{}{
+		"status_code": resp.StatusCode,
+		"latency":     latency,
+		"excerpt":     excerpt,
+	})
+	message := []byte(fmt.Sprintf("%s %s\nstatus: %s\nlatency: %vms\n\n%s", method, cronjob.URL, resp.Status, latency, excerpt))
+	if err != nil {
+		return message, fmt.Errorf("read response failed, err: %v", err)
+	}
+
+	ok, err := matchExpectStatus(cronjob.ExpectStatus, resp.StatusCode)
+	if err != nil {
+		return message, err
+	}
+	if !ok {
+		return message, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	if len(cronjob.ExpectBody) != 0 {
+		reg, err := regexp.Compile(cronjob.ExpectBody)
+		if err != nil {
+			return message, err
+		}
+		if !reg.Match(body) {
+			return message, fmt.Errorf("response body does not match %s", cronjob.ExpectBody)
+		}
+	}
+	return message, nil
+}
+
+// loadHttpHeaders parses one "Key: Value" header per line
+func loadHttpHeaders(content string) (http.Header, error) {
+	headers := make(http.Header)
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		if !ok || len(key) == 0 || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("header %s", line)
+		}
+		headers.Add(key, strings.TrimSpace(value))
+	}
+	return headers, nil
+}
+
+// matchExpectStatus checks the status code against a comma separated list of codes ("200,204")
+// or classes ("2xx"), any 2xx code is expected when the list is empty
+func matchExpectStatus(expect string, code int) (bool, error) {
+	if len(strings.TrimSpace(expect)) == 0 {
+		expect = "2xx"
+	}
+	matched := false
+	for _, item := range strings.Split(expect, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if len(item) == 3 && strings.HasSuffix(item, "xx") && item[0] >= '1' && item[0] <= '5' {
+			if code/100 == int(item[0]-'0') {
+				matched = true
+			}
+			continue
+		}
+		value, err := strconv.Atoi(item)
+		if err != nil || value < 100 || value > 599 {
+			return false, fmt.Errorf("expect status %s", item)
+		}
+		if value == code {
+			matched = true
+		}
+	}
+	return matched, nil
+}
+
+func loadHttpExcerpt(body []byte) string {
+	if len(body) > httpExcerptSize {
+		body = body[:httpExcerptSize]
+		// drop a rune cut in half at the end of the excerpt
+		for i := 0; i < utf8.UTFMax-1 && len(body) > 0; i++ {
+			if r, _ := utf8.DecodeLastRune(body); r != utf8.RuneError {
+				break
+			}
+			body = body[:len(body)-1]
+		}
+	}
+	return string(body)
+}
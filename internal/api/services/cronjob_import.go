@@ -0,0 +1,227 @@
+package services
+
+import (
+	"LinuxOnM/internal/api/dto"
+	"LinuxOnM/internal/buserr"
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/global"
+	"LinuxOnM/internal/models"
+	"LinuxOnM/internal/utils/copier"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const cronjobDocumentVersion = 1
+
+// Export writes the definitions of the cronjobs to a yaml or json document, the triggers
+// refer to their target by name so that the document can be imported on another server
+func (u *CronjobService) Export(req dto.CronjobExport) ([]byte, error) {
+	cronjobs, err := cronjobRepo.List(commonRepo.WithIdsIn(req.IDs), commonRepo.WithOrderBy("id asc"))
+	if err != nil {
+		return nil, err
+	}
+	doc := dto.CronjobDocument{Version: cronjobDocumentVersion, ExportedAt: time.Now()}
+	for _, cronjob := range cronjobs {
+		var item dto.CronjobDefinition
+		if err := copier.Copy(&item, &cronjob); err != nil {
+			return nil, errors.WithMessage(constant.ErrStructTransform, err.Error())
+		}
+		item.Envs = loadEnvs(cronjob)
+		item.Hosts, item.HostGroup = loadHostNames(cronjob)
+		for _, trigger := range loadTriggers(cronjob.ID) {
+			item.Triggers = append(item.Triggers, dto.CronjobTriggerDefinition{Target: trigger.TargetName, Condition: trigger.Condition})
+		}
+		doc.Cronjobs = append(doc.Cronjobs, item)
+	}
+	if req.Format == "json" {
+		return json.MarshalIndent(doc, "", "  ")
+	}
+	return yaml.Marshal(doc)
+}
+
+// Import creates the cronjobs of a yaml or json document and starts them, a name which is
+// already taken is skipped, renamed or overwritten according to the conflict mode. The triggers
+// are saved once all jobs exist, their targets are looked up among the imported jobs first.
+func (u *CronjobService) Import(req dto.CronjobImport) (dto.CronjobImportResult, error) {
+	result := dto.CronjobImportResult{Renamed: make(map[string]string)}
+	var doc dto.CronjobDocument
+	if err := yaml.Unmarshal([]byte(req.Content), &doc); err != nil {
+		return result, buserr.WithDetail(constant.ErrCronjobDocument, err.Error(), err)
+	}
+	if doc.Version < 1 || doc.Version > cronjobDocumentVersion {
+		return result, buserr.WithDetail(constant.ErrCronjobDocument, fmt.Sprintf("version %d", doc.Version), nil)
+	}
+
+	imported := make(map[string]models.Cronjob)
+	for _, item := range doc.Cronjobs {
+		name, err := u.importCronjob(item, req.Conflict, &result)
+		if err != nil {
+			result.Failed = append(result.Failed, fmt.Sprintf("%s: %v", item.Name, err))
+			continue
+		}
+		if len(name) == 0 {
+			continue
+		}
+		cronjob, _ := cronjobRepo.Get(commonRepo.WithByName(name))
+		imported[item.Name] = cronjob
+	}
+
+	for _, item := range doc.Cronjobs {
+		cronjob, ok := imported[item.Name]
+		if !ok || len(item.Triggers) == 0 {
+			continue
+		}
+		var triggers []dto.CronjobTrigger
+		for _, trigger := range item.Triggers {
+			target, ok := imported[trigger.Target]
+			if !ok {
+				target, _ = cronjobRepo.Get(commonRepo.WithByName(trigger.Target))
+			}
+			if target.ID == 0 {
+				result.Failed = append(result.Failed, fmt.Sprintf("%s: trigger target %s not found", item.Name, trigger.Target))
+				continue
+			}
+			triggers = append(triggers, dto.CronjobTrigger{TargetID: target.ID, Condition: trigger.Condition})
+		}
+		if err := global.VALID.Var(triggers, "omitempty,dive"); err != nil {
+			result.Failed = append(result.Failed, fmt.Sprintf("%s: %v", item.Name, err))
+			continue
+		}
+		triggerModels, err := loadTriggerModels(cronjob, triggers)
+		if err == nil {
+			err = cronjobRepo.SaveTriggers(cronjob.ID, triggerModels)
+		}
+		if err != nil {
+			result.Failed = append(result.Failed, fmt.Sprintf("%s: %v", item.Name, err))
+		}
+	}
+	return result, nil
+}
+
+// importCronjob creates or overwrites the cronjob of the definition and returns the name it was
+// saved with, the name is empty when the definition was skipped
+func (u *CronjobService) importCronjob(item dto.CronjobDefinition, conflict string, result *dto.CronjobImportResult) (string, error) {
+	var req dto.CronjobCreate
+	if err := copier.Copy(&req, &item); err != nil {
+		return "", errors.WithMessage(constant.ErrStructTransform, err.Error())
+	}
+	req.Triggers = nil
+	hostIDs, hostGroupID, err := loadHostIDs(item.Hosts, item.HostGroup)
+	if err != nil {
+		return "", err
+	}
+	req.HostIDs, req.HostGroupID = hostIDs, hostGroupID
+	if err := global.VALID.Struct(req); err != nil {
+		return "", err
+	}
+
+	exist, _ := cronjobRepo.Get(commonRepo.WithByName(item.Name))
+	if exist.ID == 0 {
+		if err := checkImportSecrets(req.Envs); err != nil {
+			return "", err
+		}
+		if err := u.Create(req); err != nil {
+			return "", err
+		}
+		result.Created = append(result.Created, req.Name)
+		return req.Name, nil
+	}
+	switch conflict {
+	case "skip":
+		result.Skipped = append(result.Skipped, item.Name)
+		return "", nil
+	case "rename":
+		for i := 1; ; i++ {
+			req.Name = fmt.Sprintf("%s-%d", item.Name, i)
+			if taken, _ := cronjobRepo.Get(commonRepo.WithByName(req.Name)); taken.ID == 0 {
+				break
+			}
+		}
+		if err := checkImportSecrets(req.Envs); err != nil {
+			return "", err
+		}
+		if err := u.Create(req); err != nil {
+			return "", err
+		}
+		result.Created = append(result.Created, req.Name)
+		result.Renamed[item.Name] = req.Name
+		return req.Name, nil
+	}
+
+	if exist.Type != item.Type {
+		return "", fmt.Errorf("the existing job is of type %s", exist.Type)
+	}
+	var update dto.CronjobUpdate
+	if err := copier.Copy(&update, &req); err != nil {
+		return "", errors.WithMessage(constant.ErrStructTransform, err.Error())
+	}
+	update.ID = exist.ID
+	// secrets are not exported, the ones of the existing job are kept and an empty passphrase keeps the stored one
+	update.Secret = exist.Secret
+	if err := u.Update(exist.ID, update); err != nil {
+		return "", err
+	}
+	result.Overwritten = append(result.Overwritten, item.Name)
+	return item.Name, nil
+}
+
+// checkImportSecrets refuses to create a job whose secret variables have no value, the values are not
+// exported and the job would run with them empty. They can be filled in the document before importing.
+func checkImportSecrets(envs []dto.CronjobEnv) error {
+	var keys []string
+	for _, env := range envs {
+		if env.Secret && len(env.Value) == 0 {
+			keys = append(keys, env.Key)
+		}
+	}
+	if len(keys) != 0 {
+		return fmt.Errorf("the secret variables %s have no value", strings.Join(keys, ", "))
+	}
+	return nil
+}
+
+// loadHostNames returns the names of the hosts and of the host group of the cronjob, ids are not
+// kept in the document as they differ between servers
+func loadHostNames(cronjob models.Cronjob) ([]string, string) {
+	var names []string
+	for _, item := range strings.Split(cronjob.HostIDs, ",") {
+		id, _ := strconv.Atoi(item)
+		if host, _ := hostRepo.Get(commonRepo.WithByID(uint(id))); host.ID != 0 {
+			names = append(names, host.Name)
+		}
+	}
+	var groupName string
+	if cronjob.HostGroupID != 0 {
+		group, _ := groupRepo.Get(commonRepo.WithByID(cronjob.HostGroupID))
+		groupName = group.Name
+	}
+	return names, groupName
+}
+
+// loadHostIDs looks up the hosts and the host group of a definition by name, a job whose hosts
+// are missing is not imported as it would otherwise run on this server
+func loadHostIDs(names []string, groupName string) (string, uint, error) {
+	var ids []string
+	for _, name := range names {
+		host, _ := hostRepo.Get(commonRepo.WithByName(name))
+		if host.ID == 0 {
+			return "", 0, fmt.Errorf("host %s not found", name)
+		}
+		ids = append(ids, strconv.Itoa(int(host.ID)))
+	}
+	var groupID uint
+	if len(groupName) != 0 {
+		group, _ := groupRepo.Get(commonRepo.WithByName(groupName), commonRepo.WithByType("host"))
+		if group.ID == 0 {
+			return "", 0, fmt.Errorf("host group %s not found", groupName)
+		}
+		groupID = group.ID
+	}
+	return strings.Join(ids, ","), groupID, nil
+}
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/global"
+	"LinuxOnM/internal/models"
+	"LinuxOnM/internal/utils/common"
+	"LinuxOnM/internal/utils/storage_client"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+const recordLogPollInterval = 500 * time.Millisecond
+
+// TailRecordLog sends the last lines of the record log (all of it when tail is not positive), in
+// follow mode the lines written afterwards are sent as well until the record reaches a terminal
+// status or the client sends "close conn"
+func (u *CronjobService) TailRecordLog(wsConn *websocket.Conn, recordID uint, tail int, follow bool) error {
+	defer wsConn.Close()
+	record, err := cronjobRepo.GetRecord(commonRepo.WithByID(recordID))
+	if err != nil {
+		return err
+	}
+	cronjob, err := cronjobRepo.Get(commonRepo.WithByID(record.CronjobID))
+	if err != nil {
+		return err
+	}
+	logPath := loadRecordLogPath(cronjob, record)
+
+	offset, err := sendRecordLogTail(wsConn, logPath, tail)
+	if err != nil {
+		return err
+	}
+	if !follow || record.Status != constant.StatusWaiting {
+		return closeRecordLog(wsConn)
+	}
+
+	exitCh := make(chan struct{})
+	go func() {
+		defer close(exitCh)
+		for {
+			_, wsData, err := wsConn.ReadMessage()
+			if err != nil || string(wsData) == "close conn" {
+				return
+			}
+		}
+	}()
+	ticker := time.NewTicker(recordLogPollInterval)
+	defer ticker.Stop()
+	var pending []byte
+	for {
+		select {
+		case <-exitCh:
+			return nil
+		case <-ticker.C:
+		}
+		// the status is loaded before reading so that the lines written before the end are not missed
+		current, _ := cronjobRepo.GetRecord(commonRepo.WithByID(recordID))
+		if current.ID != 0 && len(current.Records) != 0 {
+			logPath = current.Records
+		}
+		offset, pending, err = sendRecordLogFrom(wsConn, logPath, offset, pending)
+		if err != nil {
+			return err
+		}
+		if current.ID == 0 || current.Status != constant.StatusWaiting {
+			if len(pending) != 0 {
+				if err := wsConn.WriteMessage(websocket.TextMessage, bytes.ToValidUTF8(pending, nil)); err != nil {
+					return err
+				}
+			}
+			return closeRecordLog(wsConn)
+		}
+	}
+}
+
+// loadRecordLogPath returns the log of the record, jobs which write their output when they are
+// done only set it on the record at the end so the path is derived from the start time before
+func loadRecordLogPath(cronjob models.Cronjob, record models.JobRecords) string {
+	if len(record.Records) != 0 {
+		return record.Records
+	}
+	return fmt.Sprintf("%s/task/%s/%s/%s.log", constant.DataDir, cronjob.Type, cronjob.Name, record.StartTime.Format(constant.DateTimeSlimLayout))
+}
+
+func sendRecordLogTail(wsConn *websocket.Conn, logPath string, tail int) (int64, error) {
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	data := content
+	if tail > 0 {
+		data = loadLogTail(content, tail)
+	}
+	if len(data) != 0 {
+		if err := wsConn.WriteMessage(websocket.TextMessage, bytes.ToValidUTF8(data, nil)); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(content)), nil
+}
+
+// loadLogTail returns the last lines of the content
+func loadLogTail(content []byte, tail int) []byte {
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) <= tail {
+		return content
+	}
+	return bytes.Join(lines[len(lines)-tail:], nil)
+}
+
+// sendRecordLogFrom sends what was written to the log after offset, a rune cut in half at the end
+// is kept back until the rest of it is written
+func sendRecordLogFrom(wsConn *websocket.Conn, logPath string, offset int64, pending []byte) (int64, []byte, error) {
+	file, err := os.Open(logPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return offset, pending, nil
+		}
+		return offset, pending, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return offset, pending, err
+	}
+	if info.Size() < offset {
+		// the log was truncated, start over
+		offset, pending = 0, nil
+	}
+	if info.Size() == offset {
+		return offset, pending, nil
+	}
+	data, err := io.ReadAll(io.NewSectionReader(file, offset, info.Size()-offset))
+	if err != nil {
+		return offset, pending, err
+	}
+	offset += int64(len(data))
+	data = append(pending, data...)
+	end := len(data)
+	for i := 0; i < utf8.UTFMax-1 && end > 0; i++ {
+		if r, _ := utf8.DecodeLastRune(data[:end]); r != utf8.RuneError {
+			break
+		}
+		end--
+	}
+	pending = append([]byte(nil), data[end:]...)
+	if end != 0 {
+		if err := wsConn.WriteMessage(websocket.TextMessage, bytes.ToValidUTF8(data[:end], nil)); err != nil {
+			return offset, pending, err
+		}
+	}
+	return offset, pending, nil
+}
+
+func closeRecordLog(wsConn *websocket.Conn) error {
+	message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if err := wsConn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second)); err != nil {
+		global.LOG.Errorf("close record log ws failed, err: %v", err)
+	}
+	return nil
+}
+
+// cronjobTaskLog appends the progress of a running job to the log of its record so that it can be
+// followed while the job runs. A nil log drops the lines, the helpers the manual operations share
+// with the jobs write to it without checking.
+type cronjobTaskLog struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+func openCronjobTaskLog(logPath string) (*cronjobTaskLog, error) {
+	if err := os.MkdirAll(path.Dir(logPath), os.ModePerm); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &cronjobTaskLog{file: file}, nil
+}
+
+func (l *cronjobTaskLog) Printf(format string, a ...interface{}) {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	_, _ = fmt.Fprintf(l.file, "[%s] %s\n", time.Now().Format(constant.DateTimeLayout), fmt.Sprintf(format, a...))
+}
+
+func (l *cronjobTaskLog) Close() {
+	if l == nil {
+		return
+	}
+	_ = l.file.Close()
+}
+
+// transferProgress logs the progress of the transfer every 10 percent besides passing it on
+func (l *cronjobTaskLog) transferProgress(name string, progress storage_client.ProgressFunc) storage_client.ProgressFunc {
+	if l == nil {
+		return progress
+	}
+	lastStep := int64(-1)
+	return func(transferred, total int64) {
+		progress(transferred, total)
+		if total <= 0 {
+			return
+		}
+		step := transferred * 10 / total
+		if step == lastStep {
+			return
+		}
+		lastStep = step
+		l.Printf("%s: %s of %s transferred (%d%%)", name, common.FormatBytes(uint64(transferred)), common.FormatBytes(uint64(total)), step*10)
+	}
+}
+
+// hostLogWriter copies the output of a remote host into the log of the record as it arrives, every
+// line is prefixed with the host and written at once so that the lines of the hosts do not mix.
+// The lock is shared by the writers of all hosts, ssh writes stdout and stderr from two goroutines.
+type hostLogWriter struct {
+	lock    *sync.Mutex
+	out     io.Writer
+	prefix  string
+	partial []byte
+}
+
+// hostLogLineLimit ends a line which grows without a newline, e.g. for a progress bar
+const hostLogLineLimit = 64 * 1024
+
+func (w *hostLogWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		index := bytes.IndexByte(w.partial, '\n')
+		if index < 0 {
+			if len(w.partial) < hostLogLineLimit {
+				break
+			}
+			index = len(w.partial) - 1
+		}
+		w.writeLine(w.partial[:index+1])
+		w.partial = w.partial[index+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes the last line when the output did not end with a newline
+func (w *hostLogWriter) Flush() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if len(w.partial) != 0 {
+		w.writeLine(w.partial)
+		w.partial = nil
+	}
+}
+
+func (w *hostLogWriter) writeLine(line []byte) {
+	item := append([]byte(w.prefix), line...)
+	if item[len(item)-1] != '\n' {
+		item = append(item, '\n')
+	}
+	_, _ = w.out.Write(item)
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/models"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const cronjobNotifyLogLines = 20
+
+type notifyPolicy struct {
+	onFailure    bool
+	onSuccess    bool
+	overDuration time.Duration
+}
+
+// loadNotifyPolicy returns the notification rules of the cronjob, jobs which do not declare
+// their own rules follow the CronjobNotify* settings
+func loadNotifyPolicy(cronjob models.Cronjob) notifyPolicy {
+	switch cronjob.NotifyPolicy {
+	case constant.NotifyPolicyNone:
+		return notifyPolicy{}
+	case constant.NotifyPolicyCustom:
+		return notifyPolicy{
+			onFailure:    cronjob.NotifyOnFailure,
+			onSuccess:    cronjob.NotifyOnSuccess,
+			overDuration: time.Duration(cronjob.NotifyOverDuration) * time.Second,
+		}
+	}
+	var policy notifyPolicy
+	if setting, _ := settingRepo.Get(settingRepo.WithByKey("CronjobNotifyOnFailure")); setting.Value == constant.StatusEnable {
+		policy.onFailure = true
+	}
+	if setting, _ := settingRepo.Get(settingRepo.WithByKey("CronjobNotifyOnSuccess")); setting.Value == constant.StatusEnable {
+		policy.onSuccess = true
+	}
+	setting, _ := settingRepo.Get(settingRepo.WithByKey("CronjobNotifyOverDuration"))
+	if seconds, err := strconv.Atoi(setting.Value); err == nil && seconds > 0 {
+		policy.overDuration = time.Duration(seconds) * time.Second
+	}
+	return policy
+}
+
+// notifyRecord sends one notification for the last attempt of a record, a failure is reported
+// before a run over the duration limit and that before a success. Runs which were stopped, replaced
+// or skipped did not fail and are not reported.
+func notifyRecord(cronjob models.Cronjob, record models.JobRecords, status, message string, err error) {
+	if status == constant.StatusCancelled || status == constant.StatusSkipped {
+		return
+	}
+	policy := loadNotifyPolicy(cronjob)
+	duration := time.Since(record.StartTime)
+	var eventCode string
+	switch {
+	case status != constant.StatusSuccess && policy.onFailure:
+		eventCode = models.EventCodeCronjobFailed
+	case policy.overDuration != 0 && duration > policy.overDuration:
+		eventCode = models.EventCodeCronjobSlow
+	case status == constant.StatusSuccess && policy.onSuccess:
+		eventCode = models.EventCodeCronjobSucceed
+	default:
+		return
+	}
+
+	detail := []string{fmt.Sprintf("%s after %s", status, duration.Round(time.Second))}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		detail = append(detail, fmt.Sprintf("exit code %d", exitErr.ExitCode()))
+	}
+	if eventCode == models.EventCodeCronjobSlow {
+		detail = append(detail, fmt.Sprintf("over the limit of %s", policy.overDuration))
+	}
+	if len(message) != 0 {
+		detail = append(detail, message)
+	}
+	content := strings.Join(detail, ", ")
+	if logContent, err := os.ReadFile(record.Records); err == nil && len(logContent) != 0 {
+		content += "\n" + string(bytes.ToValidUTF8(loadLogTail(logContent, cronjobNotifyLogLines), nil))
+	}
+	NewNotificationService().SendCronjobAlert(eventCode, cronjob.Name, content)
+}
@@ -0,0 +1,307 @@
+package services
+
+import (
+	"LinuxOnM/internal/api/dto"
+	"LinuxOnM/internal/buserr"
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/global"
+	"LinuxOnM/internal/models"
+	"LinuxOnM/internal/utils/copier"
+	"LinuxOnM/internal/utils/ssh"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const cronjobRemoteConcurrency = 10
+
+// hasRemoteHosts reports whether the shell cronjob runs on remote hosts instead of the panel
+func hasRemoteHosts(cronjob models.Cronjob) bool {
+	return len(cronjob.HostIDs) != 0 || cronjob.HostGroupID != 0
+}
+
+// checkRemoteParams validates the hosts of a shell cronjob before it is saved, the container and
+// the account a local job runs as do not apply to remote hosts which run the script as their ssh user
+func checkRemoteParams(cronjob models.Cronjob) error {
+	if len(cronjob.ContainerName) != 0 || len(cronjob.RunAsUser) != 0 || len(cronjob.RunAsGroup) != 0 {
+		return buserr.WithDetail(constant.ErrCronjobShellParams, "the container and the run-as account are not supported on remote hosts", nil)
+	}
+	if _, err := loadCronjobHosts(cronjob); err != nil {
+		return buserr.WithDetail(constant.ErrCronjobShellParams, err.Error(), err)
+	}
+	return nil
+}
+
+// loadCronjobHosts returns the hosts of the group and the hosts picked one by one, a host in both
+// is returned once. A job which targets hosts never falls back to the panel, an empty group is an error.
+func loadCronjobHosts(cronjob models.Cronjob) ([]models.Host, error) {
+	var hosts []models.Host
+	seen := make(map[uint]bool)
+	if cronjob.HostGroupID != 0 {
+		group, _ := groupRepo.Get(commonRepo.WithByID(cronjob.HostGroupID), commonRepo.WithByType("host"))
+		if group.ID == 0 {
+			return nil, fmt.Errorf("host group %d not found", cronjob.HostGroupID)
+		}
+		groupHosts, err := hostRepo.GetList(commonRepo.WithByGroupID(group.ID))
+		if err != nil {
+			return nil, err
+		}
+		if len(groupHosts) == 0 {
+			return nil, fmt.Errorf("host group %s has no host", group.Name)
+		}
+		for _, host := range groupHosts {
+			seen[host.ID] = true
+			hosts = append(hosts, host)
+		}
+	}
+	for _, item := range strings.Split(cronjob.HostIDs, ",") {
+		if len(item) == 0 {
+			continue
+		}
+		id, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, fmt.Errorf("host %s not found", item)
+		}
+		host, _ := hostRepo.Get(commonRepo.WithByID(uint(id)))
+		if host.ID == 0 {
+			return nil, fmt.Errorf("host %s not found", item)
+		}
+		if !seen[host.ID] {
+			seen[host.ID] = true
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts, nil
+}
+
+// handleRemoteShell runs the script on every host of the cronjob, a few hosts at a time. Each host
+// has its own result and log under the record, the output is also copied line by line into the log of
+// the record while the hosts run and the run fails when the script failed on any host.
+func (u *CronjobService) handleRemoteShell(ctx context.Context, cronjob models.Cronjob, record models.JobRecords) error {
+	hosts, err := loadCronjobHosts(cronjob)
+	if err != nil {
+		return err
+	}
+	envs, err := loadEnvValues(cronjob)
+	if err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(record.Records, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	hostDir := strings.TrimSuffix(record.Records, ".log")
+	if err := os.MkdirAll(hostDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	script := loadRemoteScript(cronjob, envs)
+	var (
+		wg        sync.WaitGroup
+		lock      sync.Mutex
+		logLock   sync.Mutex
+		failed    []string
+		failedErr error
+	)
+	limit := make(chan struct{}, cronjobRemoteConcurrency)
+	for _, host := range hosts {
+		acquired := false
+		select {
+		case limit <- struct{}{}:
+			acquired = true
+		case <-ctx.Done():
+		}
+		// the hosts which wait for a slot are not started once the task timed out or was stopped
+		if ctx.Err() != nil {
+			if acquired {
+				<-limit
+			}
+			status, message := loadExecutionStatus(ctx, cronjob, ctx.Err())
+			hostRecord := models.CronjobHostRecord{RecordID: record.ID, HostID: host.ID, Name: host.Name, Addr: host.Addr, Status: status, Message: "not started, " + message}
+			if err := cronjobRepo.CreateHostRecord(&hostRecord); err != nil {
+				global.LOG.Errorf("create record of host %s for cronjob %s failed, err: %v", host.Name, cronjob.Name, err)
+			}
+			continue
+		}
+		wg.Add(1)
+		go func(host models.Host) {
+			defer func() {
+				<-limit
+				wg.Done()
+			}()
+			hostRecord := models.CronjobHostRecord{
+				RecordID: record.ID,
+				HostID:   host.ID,
+				Name:     host.Name,
+				Addr:     host.Addr,
+				Records:  fmt.Sprintf("%s/%d.log", hostDir, host.ID),
+				Status:   constant.StatusWaiting,
+			}
+			if err := cronjobRepo.CreateHostRecord(&hostRecord); err != nil {
+				global.LOG.Errorf("create record of host %s for cronjob %s failed, err: %v", host.Name, cronjob.Name, err)
+			}
+			output := &hostLogWriter{lock: &logLock, out: logFile, prefix: fmt.Sprintf("[%s] ", host.Name)}
+			writeHostLogLine(&logLock, logFile, fmt.Sprintf("==================== %s (%s) started ====================", host.Name, host.Addr))
+			startTime := time.Now()
+			err := runRemoteScript(ctx, host, script, hostRecord.Records, output)
+			output.Flush()
+			status, message := constant.StatusSuccess, ""
+			if err != nil {
+				status, message = loadExecutionStatus(ctx, cronjob, err)
+			}
+			_ = cronjobRepo.UpdateHostRecord(hostRecord.ID, map[string]interface{}{
+				"interval": float64(time.Since(startTime).Milliseconds()),
+				"status":   status,
+				"message":  message,
+			})
+			if err != nil {
+				writeHostLogLine(&logLock, logFile, output.prefix+message)
+			}
+			writeHostLogLine(&logLock, logFile, fmt.Sprintf("==================== %s (%s) %s ====================", host.Name, host.Addr, status))
+			if err != nil {
+				lock.Lock()
+				failed = append(failed, host.Name)
+				var exitErr *gossh.ExitError
+				if failedErr == nil || (!errors.As(failedErr, &exitErr) && errors.As(err, &exitErr)) {
+					failedErr = err
+				}
+				lock.Unlock()
+			}
+		}(host)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if len(failed) != 0 {
+		// the error of the first host the script exited with an error on is wrapped so that its exit
+		// code can be matched for retries, a host which could not be reached has no exit code
+		return fmt.Errorf("failed on %d of %d hosts: %s, %w", len(failed), len(hosts), strings.Join(failed, ", "), failedErr)
+	}
+	return nil
+}
+
+// runRemoteScript feeds the script to sh on the host and writes the output to the log of the host
+// and to output. The connection is closed when the context is done, the script is hung up on but a
+// script which ignores its output going away may keep running on the host.
+func runRemoteScript(ctx context.Context, host models.Host, script, logPath string, output io.Writer) error {
+	file, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := NewIHostService().GetHostInfo(host.ID)
+	if err != nil {
+		return err
+	}
+	connInfo := ssh.ConnInfo{
+		User:       info.User,
+		Addr:       info.Addr,
+		Port:       info.Port,
+		AuthMode:   info.AuthMode,
+		Password:   info.Password,
+		PrivateKey: []byte(info.PrivateKey),
+		PassPhrase: []byte(info.PassPhrase),
+	}
+	client, err := connInfo.NewClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	session, err := client.Client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	session.Stdin = strings.NewReader(script)
+	writer := io.MultiWriter(file, output)
+	session.Stdout = writer
+	session.Stderr = writer
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Run("sh -s")
+	}()
+	select {
+	case <-ctx.Done():
+		client.Close()
+		<-done
+		return ctx.Err()
+	case err := <-done:
+		return err
+	}
+}
+
+// loadRemoteScript builds what is fed to sh on the host, the variables are exported by it instead
+// of being put on the command line so that their values do not show up in the process list
+func loadRemoteScript(cronjob models.Cronjob, envs []string) string {
+	var builder strings.Builder
+	for _, env := range envs {
+		key, value, _ := strings.Cut(env, "=")
+		builder.WriteString(fmt.Sprintf("export %s=%s\n", key, quoteShell(value)))
+	}
+	if len(cronjob.Workdir) != 0 {
+		builder.WriteString(fmt.Sprintf("cd %s || exit 1\n", quoteShell(cronjob.Workdir)))
+	}
+	builder.WriteString(fmt.Sprintf("exec %s -c %s\n", loadInterpreter(cronjob.Interpreter, constant.InterpreterBash), quoteShell(cronjob.Script)))
+	return builder.String()
+}
+
+func writeHostLogLine(lock *sync.Mutex, out io.Writer, line string) {
+	lock.Lock()
+	defer lock.Unlock()
+	_, _ = fmt.Fprintln(out, line)
+}
+
+func quoteShell(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+func loadHostResults(recordID uint) []dto.CronjobHostResult {
+	hostRecords, _ := cronjobRepo.ListHostRecords(cronjobRepo.WithByRecordID(recordID), commonRepo.WithOrderBy("name asc"))
+	var items []dto.CronjobHostResult
+	for _, hostRecord := range hostRecords {
+		var item dto.CronjobHostResult
+		if err := copier.Copy(&item, &hostRecord); err != nil {
+			global.LOG.Errorf("load result of host %s failed, err: %v", hostRecord.Name, err)
+			continue
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// removeHostRecords removes the results of the remote hosts of the record with their logs
+func removeHostRecords(record models.JobRecords) {
+	hostRecords, _ := cronjobRepo.ListHostRecords(cronjobRepo.WithByRecordID(record.ID))
+	if len(hostRecords) == 0 {
+		return
+	}
+	for _, hostRecord := range hostRecords {
+		_ = os.Remove(hostRecord.Records)
+	}
+	_ = os.Remove(path.Dir(hostRecords[0].Records))
+	_ = cronjobRepo.DeleteHostRecords(cronjobRepo.WithByRecordID(record.ID))
+}
+
+func (u *CronjobService) LoadHostRecordLog(req dto.OperateByID) string {
+	hostRecord, err := cronjobRepo.GetHostRecord(commonRepo.WithByID(req.ID))
+	if err != nil {
+		return ""
+	}
+	content, err := os.ReadFile(hostRecord.Records)
+	if err != nil {
+		return ""
+	}
+	return string(content)
+}
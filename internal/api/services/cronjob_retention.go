@@ -0,0 +1,119 @@
+package services
+
+import (
+	"LinuxOnM/internal/api/dto"
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/models"
+	"fmt"
+	"time"
+)
+
+// retentionPolicy follows the grandfather-father-son scheme: besides the last copies, the newest
+// record of each of the latest days, weeks, months and years is kept, as well as every record
+// younger than the minimum age. A record is deleted only when no rule keeps it.
+type retentionPolicy struct {
+	Last    int
+	Daily   int
+	Weekly  int
+	Monthly int
+	Yearly  int
+	MinAge  int
+}
+
+func loadRetentionPolicy(cronjob models.Cronjob) retentionPolicy {
+	return retentionPolicy{
+		Last:    int(cronjob.RetainCopies),
+		Daily:   int(cronjob.RetainDaily),
+		Weekly:  int(cronjob.RetainWeekly),
+		Monthly: int(cronjob.RetainMonthly),
+		Yearly:  int(cronjob.RetainYearly),
+		MinAge:  int(cronjob.RetainMinAge),
+	}
+}
+
+// apply returns the reasons each record is kept for, times must be sorted newest first
+// and records without any reason are expired
+func (p retentionPolicy) apply(times []time.Time, now time.Time) [][]string {
+	reasons := make([][]string, len(times))
+	minAge := time.Duration(p.MinAge) * 24 * time.Hour
+	for i, item := range times {
+		if i < p.Last {
+			reasons[i] = append(reasons[i], "last")
+		}
+		if p.MinAge > 0 && now.Sub(item) < minAge {
+			reasons[i] = append(reasons[i], "minAge")
+		}
+	}
+
+	buckets := []struct {
+		name  string
+		count int
+		key   func(time.Time) string
+	}{
+		{name: "daily", count: p.Daily, key: func(t time.Time) string { return t.Format("2006-01-02") }},
+		{name: "weekly", count: p.Weekly, key: func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%d", year, week)
+		}},
+		{name: "monthly", count: p.Monthly, key: func(t time.Time) string { return t.Format("2006-01") }},
+		{name: "yearly", count: p.Yearly, key: func(t time.Time) string { return t.Format("2006") }},
+	}
+	for _, bucket := range buckets {
+		lastKey, kept := "", 0
+		for i, item := range times {
+			if kept >= bucket.count {
+				break
+			}
+			key := bucket.key(item.Local())
+			if key == lastKey {
+				continue
+			}
+			lastKey = key
+			kept++
+			reasons[i] = append(reasons[i], bucket.name)
+		}
+	}
+	return reasons
+}
+
+func (u *CronjobService) PreviewRetention(req dto.RetentionPreview) (dto.RetentionPreviewResult, error) {
+	result := dto.RetentionPreviewResult{Keep: []dto.RetentionItem{}, Delete: []dto.RetentionItem{}}
+	cronjob, _ := cronjobRepo.Get(commonRepo.WithByID(req.CronjobID))
+	if cronjob.ID == 0 {
+		return result, constant.ErrRecordNotFound
+	}
+	policy := retentionPolicy{
+		Last:    req.RetainCopies,
+		Daily:   req.RetainDaily,
+		Weekly:  req.RetainWeekly,
+		Monthly: req.RetainMonthly,
+		Yearly:  req.RetainYearly,
+		MinAge:  req.RetainMinAge,
+	}
+
+	var items []dto.RetentionItem
+	if hasBackup(cronjob.Type) {
+		records, _ := backupRepo.ListRecord(commonRepo.WithByFrom("cronjob"), backupRepo.WithByCronID(cronjob.ID), commonRepo.WithOrderBy("created_at desc"))
+		for _, record := range records {
+			items = append(items, dto.RetentionItem{ID: record.ID, Name: record.FileName, Time: record.CreatedAt})
+		}
+	} else {
+		records, _ := cronjobRepo.ListRecord(cronjobRepo.WithByJobID(int(cronjob.ID)), commonRepo.WithOrderBy("created_at desc"))
+		for _, record := range records {
+			items = append(items, dto.RetentionItem{ID: record.ID, Name: record.StartTime.Format(constant.DateTimeLayout), Time: record.StartTime})
+		}
+	}
+	times := make([]time.Time, 0, len(items))
+	for _, item := range items {
+		times = append(times, item.Time)
+	}
+	for i, reasons := range policy.apply(times, time.Now()) {
+		items[i].Reasons = reasons
+		if len(reasons) == 0 {
+			result.Delete = append(result.Delete, items[i])
+		} else {
+			result.Keep = append(result.Keep, items[i])
+		}
+	}
+	return result, nil
+}
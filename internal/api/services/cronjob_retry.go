@@ -0,0 +1,129 @@
+package services
+
+import (
+	"LinuxOnM/internal/buserr"
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/global"
+	"LinuxOnM/internal/models"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	cronjobDefaultRetryDelay = time.Minute
+	cronjobMaxRetryDelay     = time.Hour
+)
+
+// retryRecord starts the next attempt of a failed or timed out record after the backoff delay,
+// stopped records are not retried. The next record is created right away so that a workflow run
+// is not ended while the attempt waits, every attempt points at the first record with RetryOf.
+func (u *CronjobService) retryRecord(cronjob *models.Cronjob, record models.JobRecords, status string, err error) bool {
+	if status != constant.StatusFailed && status != constant.StatusTimeout {
+		return false
+	}
+	if uint64(record.Attempt) >= cronjob.RetryMaxAttempts || !matchRetryExitCode(cronjob.RetryExitCodes, err) {
+		return false
+	}
+	retryOf := record.RetryOf
+	if retryOf == 0 {
+		retryOf = record.ID
+	}
+	next := cronjobRepo.StartRecords(cronjob.ID, cronjob.KeepLocal, "")
+	next.Attempt, next.RetryOf, next.WorkflowRunID, next.TriggeredBy = record.Attempt+1, retryOf, record.WorkflowRunID, record.TriggeredBy
+	_ = cronjobRepo.UpdateRecords(next.ID, map[string]interface{}{
+		"attempt":         next.Attempt,
+		"retry_of":        next.RetryOf,
+		"workflow_run_id": next.WorkflowRunID,
+		"triggered_by":    next.TriggeredBy,
+	})
+	delay := loadRetryDelay(*cronjob, record.Attempt)
+	global.LOG.Infof("cronjob %s %s on attempt %d, retry in %s", cronjob.Name, status, record.Attempt, delay)
+	time.AfterFunc(delay, func() {
+		// a replaced job cancels the attempts waiting for their turn
+		if current, _ := cronjobRepo.GetRecord(commonRepo.WithByID(next.ID)); current.Status != constant.StatusWaiting {
+			return
+		}
+		next.StartTime = time.Now()
+		_ = cronjobRepo.UpdateRecords(next.ID, map[string]interface{}{"start_time": next.StartTime})
+		u.runRecord(cronjob, next)
+	})
+	return true
+}
+
+// loadRetryDelay returns the delay before the attempt after the given one, the exponential
+// backoff doubles the delay with every attempt up to an hour
+func loadRetryDelay(cronjob models.Cronjob, attempt uint) time.Duration {
+	delay := cronjobDefaultRetryDelay
+	if cronjob.RetryDelay != 0 {
+		delay = time.Duration(cronjob.RetryDelay) * time.Second
+	}
+	if cronjob.RetryBackoff != constant.RetryBackoffExponential {
+		return delay
+	}
+	limit := cronjobMaxRetryDelay
+	if delay > limit {
+		limit = delay
+	}
+	for i := uint(1); i < attempt; i++ {
+		delay *= 2
+		if delay >= limit {
+			return limit
+		}
+	}
+	return delay
+}
+
+// matchRetryExitCode reports whether the error is retried, any error is when no exit codes are
+// set, otherwise only scripts which exited with one of the codes, on the panel or on a remote host, are
+func matchRetryExitCode(content string, err error) bool {
+	codes, _ := loadRetryExitCodes(content)
+	if len(codes) == 0 {
+		return true
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return slices.Contains(codes, exitErr.ExitCode())
+	}
+	var sshExitErr *gossh.ExitError
+	if errors.As(err, &sshExitErr) {
+		return slices.Contains(codes, sshExitErr.ExitStatus())
+	}
+	return false
+}
+
+// checkRetryExitCodes validates the exit codes, only shell jobs end with an exit code, the codes
+// would never match the errors of the other types
+func checkRetryExitCodes(cronjobType, content string) error {
+	codes, err := loadRetryExitCodes(content)
+	if err != nil {
+		return err
+	}
+	if len(codes) != 0 && cronjobType != "shell" {
+		return buserr.WithDetail(constant.ErrCronjobRetryCodes, fmt.Sprintf("%s jobs do not end with an exit code", cronjobType), nil)
+	}
+	return nil
+}
+
+// loadRetryExitCodes parses the comma separated exit codes
+func loadRetryExitCodes(content string) ([]int, error) {
+	var codes []int
+	for _, item := range strings.Split(content, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		code, err := strconv.Atoi(item)
+		if err != nil || code < 0 || code > 255 {
+			return nil, buserr.WithDetail(constant.ErrCronjobRetryCodes, fmt.Sprintf("exit code %s", item), err)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"LinuxOnM/internal/api/dto"
+	"LinuxOnM/internal/buserr"
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/global"
+	"LinuxOnM/internal/models"
+	"LinuxOnM/internal/utils/cmd"
+	"LinuxOnM/internal/utils/encrypt"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path"
+	"regexp"
+	"strconv"
+	"syscall"
+)
+
+var cronjobEnvKeyRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// checkShellParams validates the account and the working directory of a shell cronjob before it is
+// saved, the account of a job run in a container is only known to docker and is resolved when it runs
+func checkShellParams(cronjob models.Cronjob) error {
+	if len(cronjob.Workdir) != 0 && !path.IsAbs(cronjob.Workdir) {
+		return buserr.WithDetail(constant.ErrCronjobShellParams, fmt.Sprintf("workdir %s", cronjob.Workdir), nil)
+	}
+	if hasRemoteHosts(cronjob) {
+		return checkRemoteParams(cronjob)
+	}
+	if len(cronjob.ContainerName) != 0 {
+		if len(cronjob.RunAsGroup) != 0 && len(cronjob.RunAsUser) == 0 {
+			return buserr.WithDetail(constant.ErrCronjobShellParams, "the group of a container job needs a user", nil)
+		}
+		return nil
+	}
+	if _, _, err := loadShellCredential(cronjob); err != nil {
+		return buserr.WithDetail(constant.ErrCronjobShellParams, err.Error(), err)
+	}
+	return nil
+}
+
+// handleShell runs the script of a shell cronjob with its interpreter, account, working directory
+// and environment, either on the host or in its container with docker exec. A timeout or a stop
+// kills the process group on the host, for a container job that is the docker client only: docker
+// exec has no way to signal the exec session, so the script keeps running in the container until
+// it ends or the container is stopped.
+func (u *CronjobService) handleShell(ctx context.Context, cronjob models.Cronjob, logPath string) error {
+	handleDir := fmt.Sprintf("%s/task/%s/%s", constant.DataDir, cronjob.Type, cronjob.Name)
+	if _, err := os.Stat(handleDir); err != nil && os.IsNotExist(err) {
+		if err = os.MkdirAll(handleDir, os.ModePerm); err != nil {
+			return err
+		}
+	}
+	envs, err := loadEnvValues(cronjob)
+	if err != nil {
+		return err
+	}
+	var command *exec.Cmd
+	if len(cronjob.ContainerName) != 0 {
+		command = loadContainerCommand(cronjob, envs)
+		command.Dir = handleDir
+	} else {
+		command, err = loadHostCommand(cronjob, envs)
+		if err != nil {
+			return err
+		}
+		if len(command.Dir) == 0 {
+			command.Dir = handleDir
+		}
+	}
+	return cmd.RunCronjobWithContext(ctx, command, logPath)
+}
+
+func loadHostCommand(cronjob models.Cronjob, envs []string) (*exec.Cmd, error) {
+	command := exec.Command(loadInterpreter(cronjob.Interpreter, constant.InterpreterBash), "-c", cronjob.Script)
+	command.Dir = cronjob.Workdir
+	command.Env = os.Environ()
+	credential, account, err := loadShellCredential(cronjob)
+	if err != nil {
+		return nil, err
+	}
+	if credential != nil {
+		command.SysProcAttr = &syscall.SysProcAttr{Credential: credential}
+	}
+	if account != nil {
+		command.Env = append(command.Env, "HOME="+account.HomeDir, "USER="+account.Username, "LOGNAME="+account.Username)
+	}
+	command.Env = append(command.Env, envs...)
+	return command, nil
+}
+
+// loadContainerCommand builds the docker exec of the script, the values of the variables are handed
+// to the docker client through its environment so that they do not show up in the process list
+func loadContainerCommand(cronjob models.Cronjob, envs []string) *exec.Cmd {
+	interpreter := cronjob.Command
+	if len(cronjob.Interpreter) != 0 || len(interpreter) == 0 {
+		interpreter = loadInterpreter(cronjob.Interpreter, constant.InterpreterSh)
+	}
+	args := []string{"exec"}
+	if len(cronjob.RunAsUser) != 0 {
+		account := cronjob.RunAsUser
+		if len(cronjob.RunAsGroup) != 0 {
+			account += ":" + cronjob.RunAsGroup
+		}
+		args = append(args, "-u", account)
+	}
+	if len(cronjob.Workdir) != 0 {
+		args = append(args, "-w", cronjob.Workdir)
+	}
+	for _, env := range loadStoredEnvs(cronjob) {
+		args = append(args, "-e", env.Key)
+	}
+	args = append(args, cronjob.ContainerName, interpreter, "-c", cronjob.Script)
+	command := exec.Command("docker", args...)
+	command.Env = append(os.Environ(), envs...)
+	return command
+}
+
+func loadInterpreter(interpreter, defaultInterpreter string) string {
+	switch interpreter {
+	case constant.InterpreterBash:
+		return "bash"
+	case constant.InterpreterSh:
+		return "sh"
+	case constant.InterpreterPython:
+		return "python3"
+	}
+	return defaultInterpreter
+}
+
+// loadShellCredential resolves the account the script runs as on the host, nil is returned when it
+// runs as the panel. The user and the group are looked up by name or by id, the groups of the user
+// are kept and the group replaces its primary group.
+func loadShellCredential(cronjob models.Cronjob) (*syscall.Credential, *user.User, error) {
+	if len(cronjob.RunAsUser) == 0 && len(cronjob.RunAsGroup) == 0 {
+		return nil, nil, nil
+	}
+	credential := &syscall.Credential{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid()), NoSetGroups: true}
+	var account *user.User
+	if len(cronjob.RunAsUser) != 0 {
+		var err error
+		account, err = user.Lookup(cronjob.RunAsUser)
+		if err != nil {
+			if account, err = user.LookupId(cronjob.RunAsUser); err != nil {
+				return nil, nil, fmt.Errorf("user %s not found", cronjob.RunAsUser)
+			}
+		}
+		uid, _ := strconv.ParseUint(account.Uid, 10, 32)
+		gid, _ := strconv.ParseUint(account.Gid, 10, 32)
+		credential.Uid, credential.Gid, credential.NoSetGroups = uint32(uid), uint32(gid), false
+		groupIDs, _ := account.GroupIds()
+		for _, item := range groupIDs {
+			if id, err := strconv.ParseUint(item, 10, 32); err == nil {
+				credential.Groups = append(credential.Groups, uint32(id))
+			}
+		}
+	}
+	if len(cronjob.RunAsGroup) != 0 {
+		group, err := user.LookupGroup(cronjob.RunAsGroup)
+		if err != nil {
+			if group, err = user.LookupGroupId(cronjob.RunAsGroup); err != nil {
+				return nil, nil, fmt.Errorf("group %s not found", cronjob.RunAsGroup)
+			}
+		}
+		gid, _ := strconv.ParseUint(group.Gid, 10, 32)
+		credential.Gid = uint32(gid)
+	}
+	return credential, account, nil
+}
+
+// loadEnvironment validates the variables and returns them the way they are stored on the cronjob,
+// secret values are encrypted and an empty secret value keeps the value stored for the key
+func loadEnvironment(exist models.Cronjob, envs []dto.CronjobEnv) (string, error) {
+	if len(envs) == 0 {
+		return "", nil
+	}
+	stored := make(map[string]dto.CronjobEnv)
+	for _, env := range loadStoredEnvs(exist) {
+		stored[env.Key] = env
+	}
+	keys := make(map[string]bool)
+	for i, env := range envs {
+		if !cronjobEnvKeyRegex.MatchString(env.Key) || keys[env.Key] {
+			return "", buserr.WithDetail(constant.ErrCronjobShellParams, fmt.Sprintf("env %s", env.Key), nil)
+		}
+		keys[env.Key] = true
+		if !env.Secret {
+			continue
+		}
+		if len(env.Value) == 0 && stored[env.Key].Secret {
+			envs[i].Value = stored[env.Key].Value
+			continue
+		}
+		value, err := encrypt.StringEncrypt(env.Value)
+		if err != nil {
+			return "", err
+		}
+		envs[i].Value = value
+	}
+	environment, err := json.Marshal(envs)
+	if err != nil {
+		return "", err
+	}
+	return string(environment), nil
+}
+
+func loadStoredEnvs(cronjob models.Cronjob) []dto.CronjobEnv {
+	var envs []dto.CronjobEnv
+	if len(cronjob.Environment) == 0 {
+		return envs
+	}
+	if err := json.Unmarshal([]byte(cronjob.Environment), &envs); err != nil {
+		global.LOG.Errorf("load environment of cronjob %s failed, err: %v", cronjob.Name, err)
+	}
+	return envs
+}
+
+// loadEnvs returns the variables of the cronjob with the values of the secret ones left empty
+func loadEnvs(cronjob models.Cronjob) []dto.CronjobEnv {
+	envs := loadStoredEnvs(cronjob)
+	for i := range envs {
+		if envs[i].Secret {
+			envs[i].Value = ""
+		}
+	}
+	return envs
+}
+
+// loadEnvValues returns the variables as KEY=VALUE with the secret values decrypted
+func loadEnvValues(cronjob models.Cronjob) ([]string, error) {
+	var values []string
+	for _, env := range loadStoredEnvs(cronjob) {
+		value := env.Value
+		if env.Secret {
+			var err error
+			if value, err = encrypt.StringDecrypt(env.Value); err != nil {
+				return nil, fmt.Errorf("decrypt env %s failed, err: %v", env.Key, err)
+			}
+		}
+		values = append(values, env.Key+"="+value)
+	}
+	return values, nil
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"LinuxOnM/internal/api/dto"
+	"LinuxOnM/internal/buserr"
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/global"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const cronjobSpecPreviewCount = 5
+
+var (
+	cronWeekdayNames = []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+	cronMonthNames   = []string{"", "January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}
+)
+
+// PreviewSpec validates the comma separated specs the way StartJob schedules them and returns
+// the next fire times in the time zone of the scheduler
+func (u *CronjobService) PreviewSpec(req dto.CronjobSpecPreview) (dto.CronjobSpecResult, error) {
+	count := req.Count
+	if count == 0 {
+		count = cronjobSpecPreviewCount
+	}
+	loc := loadCronLocation()
+	result := dto.CronjobSpecResult{Valid: true, TimeZone: loc.String()}
+	var schedules []cron.Schedule
+	for _, spec := range strings.Split(req.Spec, ",") {
+		item := dto.CronjobSpecItem{Spec: spec}
+		schedule, err := parseCronSpec(spec)
+		if err != nil {
+			item.Error = err.Error()
+			result.Valid = false
+		} else {
+			item.Description = describeCronSpec(spec)
+			schedules = append(schedules, schedule)
+		}
+		result.Specs = append(result.Specs, item)
+	}
+	for _, next := range loadNextRunTimes(schedules, time.Now().In(loc), count) {
+		result.NextTimes = append(result.NextTimes, next.In(loc).Format(constant.DateTimeLayout))
+	}
+	return result, nil
+}
+
+// checkCronSpec rejects specs the scheduler would fail to add
+func checkCronSpec(spec string) error {
+	for _, item := range strings.Split(spec, ",") {
+		if _, err := parseCronSpec(item); err != nil {
+			return buserr.WithDetail(constant.ErrCronjobSpec, fmt.Sprintf("%s: %v", item, err), err)
+		}
+	}
+	return nil
+}
+
+// parseCronSpec parses the spec like the scheduler does, a time zone prefix without fields after it
+// is rejected first because the parser panics on it
+func parseCronSpec(spec string) (cron.Schedule, error) {
+	if (strings.HasPrefix(spec, "TZ=") || strings.HasPrefix(spec, "CRON_TZ=")) && !strings.Contains(spec, " ") {
+		return nil, fmt.Errorf("no fields after the time zone of %s", spec)
+	}
+	return cron.ParseStandard(spec)
+}
+
+func loadCronLocation() *time.Location {
+	if global.Cron != nil {
+		return global.Cron.Location()
+	}
+	return time.Local
+}
+
+// loadNextRunTime returns the next time the spec fires, the zero time for an invalid spec
+func loadNextRunTime(spec string) time.Time {
+	var schedules []cron.Schedule
+	for _, item := range strings.Split(spec, ",") {
+		schedule, err := parseCronSpec(item)
+		if err != nil {
+			return time.Time{}
+		}
+		schedules = append(schedules, schedule)
+	}
+	times := loadNextRunTimes(schedules, time.Now().In(loadCronLocation()), 1)
+	if len(times) == 0 {
+		return time.Time{}
+	}
+	return times[0]
+}
+
+// loadNextRunTimes merges the fire times of the schedules, a time several schedules fire at is returned once
+func loadNextRunTimes(schedules []cron.Schedule, from time.Time, count int) []time.Time {
+	nexts := make([]time.Time, len(schedules))
+	for i, schedule := range schedules {
+		nexts[i] = schedule.Next(from)
+	}
+	var times []time.Time
+	for len(times) < count {
+		index := -1
+		for i, next := range nexts {
+			if !next.IsZero() && (index == -1 || next.Before(nexts[index])) {
+				index = i
+			}
+		}
+		if index == -1 {
+			break
+		}
+		next := nexts[index]
+		if len(times) == 0 || !next.Equal(times[len(times)-1]) {
+			times = append(times, next)
+		}
+		nexts[index] = schedules[index].Next(next)
+	}
+	return times
+}
+
+// describeCronSpec renders a spec accepted by parseCronSpec in plain english
+func describeCronSpec(spec string) string {
+	spec = strings.TrimSpace(spec)
+	var zone string
+	if strings.HasPrefix(spec, "TZ=") || strings.HasPrefix(spec, "CRON_TZ=") {
+		index := strings.Index(spec, " ")
+		if index == -1 {
+			return spec
+		}
+		zone = fmt.Sprintf(" (%s)", spec[strings.Index(spec, "=")+1:index])
+		spec = strings.TrimSpace(spec[index:])
+	}
+	if strings.HasPrefix(spec, "@") {
+		return describeCronDescriptor(spec) + zone
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return spec
+	}
+	parts := []string{describeCronTime(fields[0], fields[1])}
+	domSet := fields[2] != "*" && fields[2] != "?"
+	dowSet := fields[4] != "*" && fields[4] != "?"
+	days := describeCronField(fields[2], "day", nil) + " of the month"
+	weekdays := describeCronField(fields[4], "weekday", cronWeekdayNames)
+	switch {
+	case domSet && dowSet:
+		parts = append(parts, fmt.Sprintf("on %s or on %s", days, weekdays))
+	case domSet:
+		parts = append(parts, "on "+days)
+	case dowSet:
+		parts = append(parts, "on "+weekdays)
+	}
+	if fields[3] != "*" && fields[3] != "?" {
+		parts = append(parts, "in "+describeCronField(fields[3], "month", cronMonthNames))
+	}
+	return strings.Join(parts, ", ") + zone
+}
+
+func describeCronDescriptor(spec string) string {
+	switch spec {
+	case "@yearly", "@annually":
+		return "At 00:00 on January 1"
+	case "@monthly":
+		return "At 00:00 on day 1 of the month"
+	case "@weekly":
+		return "At 00:00 on Sunday"
+	case "@daily", "@midnight":
+		return "At 00:00"
+	case "@hourly":
+		return "At minute 0 of every hour"
+	}
+	if value, ok := strings.CutPrefix(spec, "@every "); ok {
+		if duration, err := time.ParseDuration(strings.TrimSpace(value)); err == nil {
+			return "Every " + duration.String()
+		}
+	}
+	return spec
+}
+
+func describeCronTime(minute, hour string) string {
+	minuteValue, minuteErr := strconv.Atoi(minute)
+	hourValue, hourErr := strconv.Atoi(hour)
+	switch {
+	case minuteErr == nil && hourErr == nil:
+		return fmt.Sprintf("At %02d:%02d", hourValue, minuteValue)
+	case hour == "*" && minute == "*":
+		return "Every minute"
+	case hour == "*" && strings.HasPrefix(minute, "*/"):
+		return "Every " + strings.TrimPrefix(minute, "*/") + " minutes"
+	case hour == "*":
+		return fmt.Sprintf("At %s of every hour", describeCronField(minute, "minute", nil))
+	}
+	return fmt.Sprintf("At %s of %s", describeCronField(minute, "minute", nil), describeCronField(hour, "hour", nil))
+}
+
+// describeCronField describes one field of a spec, "*", "*/n", "a", "a-b", "a/n" and "a-b/n"
+// are known, values of fields with names are shown with their name
+func describeCronField(field, unit string, names []string) string {
+	name := func(value string) string {
+		if index, err := strconv.Atoi(value); err == nil && index >= 0 && index < len(names) {
+			return names[index]
+		}
+		for _, item := range names {
+			if len(item) >= 3 && strings.EqualFold(item[:3], value) {
+				return item
+			}
+		}
+		if len(names) != 0 {
+			return value
+		}
+		return fmt.Sprintf("%s %s", unit, value)
+	}
+	rangePart, step, hasStep := strings.Cut(field, "/")
+	if rangePart == "*" || rangePart == "?" {
+		if hasStep {
+			return fmt.Sprintf("every %s %ss", step, unit)
+		}
+		return "every " + unit
+	}
+	from, to, isRange := strings.Cut(rangePart, "-")
+	switch {
+	case hasStep && isRange:
+		return fmt.Sprintf("every %s %ss from %s through %s", step, unit, name(from), name(to))
+	case hasStep:
+		return fmt.Sprintf("every %s %ss from %s", step, unit, name(from))
+	case isRange && len(names) != 0:
+		return fmt.Sprintf("%s through %s", name(from), name(to))
+	case isRange:
+		return fmt.Sprintf("%ss %s through %s", unit, from, to)
+	}
+	return name(rangePart)
+}
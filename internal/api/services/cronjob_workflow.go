@@ -0,0 +1,264 @@
+package services
+
+import (
+	"LinuxOnM/internal/api/dto"
+	"LinuxOnM/internal/buserr"
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/global"
+	"LinuxOnM/internal/models"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A cronjob with triggers starts a workflow run, the jobs it triggers (and the jobs these trigger)
+// are recorded in the same run. Triggered jobs run whatever their own status is, so a job which
+// should only run as a step of a workflow can be disabled. A job runs at most once per workflow
+// run, a job triggered by several upstream jobs starts once all of them which take part in the run
+// ended with a status matching their conditions. Upstream jobs which did not run and can no longer
+// be reached from a running job of the run are left out, a skipped job triggers nothing.
+var workflowLock sync.Mutex
+
+// loadTriggerModels checks that the triggers point at existing jobs without closing a cycle,
+// a cronjob which is not created yet has no upstream jobs and cannot be part of one
+func loadTriggerModels(cronjob models.Cronjob, items []dto.CronjobTrigger) ([]models.CronjobTrigger, error) {
+	allTriggers, err := cronjobRepo.ListTriggers()
+	if err != nil {
+		return nil, err
+	}
+	graph := make(map[uint][]uint)
+	for _, trigger := range allTriggers {
+		if trigger.CronjobID != cronjob.ID {
+			graph[trigger.CronjobID] = append(graph[trigger.CronjobID], trigger.TargetID)
+		}
+	}
+	var triggers []models.CronjobTrigger
+	for _, item := range items {
+		target, _ := cronjobRepo.Get(commonRepo.WithByID(item.TargetID))
+		if target.ID == 0 {
+			return nil, buserr.WithName(constant.ErrCronjobTrigger, fmt.Sprintf("%d", item.TargetID))
+		}
+		if cronjob.ID != 0 && (target.ID == cronjob.ID || reachJob(graph, target.ID, cronjob.ID, map[uint]bool{})) {
+			return nil, buserr.WithName(constant.ErrCronjobTriggerCycle, target.Name)
+		}
+		graph[cronjob.ID] = append(graph[cronjob.ID], target.ID)
+		triggers = append(triggers, models.CronjobTrigger{CronjobID: cronjob.ID, TargetID: target.ID, Condition: item.Condition})
+	}
+	return triggers, nil
+}
+
+func reachJob(graph map[uint][]uint, from, to uint, visited map[uint]bool) bool {
+	if from == to {
+		return true
+	}
+	if visited[from] {
+		return false
+	}
+	visited[from] = true
+	for _, next := range graph[from] {
+		if reachJob(graph, next, to, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+func loadTriggers(cronjobID uint) []dto.CronjobTrigger {
+	triggers, _ := cronjobRepo.ListTriggers(cronjobRepo.WithByJobID(int(cronjobID)))
+	var items []dto.CronjobTrigger
+	for _, trigger := range triggers {
+		target, _ := cronjobRepo.Get(commonRepo.WithByID(trigger.TargetID))
+		items = append(items, dto.CronjobTrigger{TargetID: trigger.TargetID, TargetName: target.Name, Condition: trigger.Condition})
+	}
+	return items
+}
+
+// startWorkflowRun creates the workflow run of a cronjob with triggers, jobs without triggers
+// are not part of a workflow and 0 is returned for them
+func startWorkflowRun(cronjob models.Cronjob) uint {
+	triggers, _ := cronjobRepo.ListTriggers(cronjobRepo.WithByJobID(int(cronjob.ID)))
+	if len(triggers) == 0 {
+		return 0
+	}
+	run := models.WorkflowRun{CronjobID: cronjob.ID, StartTime: time.Now(), Status: constant.StatusRunning}
+	if err := cronjobRepo.CreateWorkflowRun(&run); err != nil {
+		global.LOG.Errorf("create workflow run of cronjob %s failed, err: %v", cronjob.Name, err)
+		return 0
+	}
+	return run.ID
+}
+
+// handleTriggers starts the downstream jobs of the workflow run whose upstream jobs all ended with
+// a matching status and ends the workflow run when no job of it is running any more. Every job which
+// has not run yet is checked, the end of a job can also release a job it is not upstream of.
+func (u *CronjobService) handleTriggers(cronjob models.Cronjob, record models.JobRecords, status string) {
+	if record.WorkflowRunID == 0 {
+		return
+	}
+	workflowLock.Lock()
+	defer workflowLock.Unlock()
+	run := loadWorkflowRunState(record.WorkflowRunID)
+	allTriggers, _ := cronjobRepo.ListTriggers()
+	graph := make(map[uint][]uint)
+	upstreams := make(map[uint][]models.CronjobTrigger)
+	for _, trigger := range allTriggers {
+		graph[trigger.CronjobID] = append(graph[trigger.CronjobID], trigger.TargetID)
+		upstreams[trigger.TargetID] = append(upstreams[trigger.TargetID], trigger)
+	}
+	for _, trigger := range allTriggers {
+		sourceStatus, ok := run.statuses[trigger.CronjobID]
+		if !ok || sourceStatus == constant.StatusWaiting || run.started[trigger.TargetID] {
+			continue
+		}
+		if !run.isReady(upstreams[trigger.TargetID], graph) {
+			continue
+		}
+		target, err := cronjobRepo.Get(commonRepo.WithByID(trigger.TargetID))
+		if err != nil {
+			global.LOG.Errorf("load downstream job %d of cronjob %s failed, err: %v", trigger.TargetID, cronjob.Name, err)
+			continue
+		}
+		global.LOG.Infof("cronjob %s ended with %s, the upstream jobs of %s ended, trigger it", cronjob.Name, status, target.Name)
+		u.handleJob(&target, record.WorkflowRunID, record.ID)
+		run.started[target.ID] = true
+		run.statuses[target.ID] = constant.StatusWaiting
+	}
+	endWorkflowRun(record.WorkflowRunID)
+}
+
+type workflowRunState struct {
+	// statuses holds the status of the last record of the jobs which ran, skipped jobs are left out
+	statuses map[uint]string
+	started  map[uint]bool
+}
+
+func loadWorkflowRunState(runID uint) workflowRunState {
+	state := workflowRunState{statuses: make(map[uint]string), started: make(map[uint]bool)}
+	records, _ := cronjobRepo.ListRecord(cronjobRepo.WithByWorkflowRunID(runID), commonRepo.WithOrderBy("id asc"))
+	for _, item := range records {
+		state.started[item.CronjobID] = true
+		if item.Status != constant.StatusSkipped {
+			state.statuses[item.CronjobID] = item.Status
+		}
+	}
+	return state
+}
+
+// isReady reports whether all the upstream jobs of a target ended with a status matching their
+// condition, an upstream job which did not run is waited for while a running job can still reach it
+func (s workflowRunState) isReady(upstreams []models.CronjobTrigger, graph map[uint][]uint) bool {
+	matched := false
+	for _, upstream := range upstreams {
+		status, ok := s.statuses[upstream.CronjobID]
+		if !ok {
+			if !s.started[upstream.CronjobID] && s.canReach(upstream.CronjobID, graph) {
+				return false
+			}
+			continue
+		}
+		if status == constant.StatusWaiting || !matchTrigger(upstream.Condition, status) {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+func (s workflowRunState) canReach(jobID uint, graph map[uint][]uint) bool {
+	for id, status := range s.statuses {
+		if status == constant.StatusWaiting && reachJob(graph, id, jobID, map[uint]bool{}) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchTrigger(condition, status string) bool {
+	switch condition {
+	case constant.TriggerOnAlways:
+		return true
+	case constant.TriggerOnSuccess:
+		return status == constant.StatusSuccess
+	case constant.TriggerOnFailed:
+		return status != constant.StatusSuccess
+	}
+	return false
+}
+
+// endWorkflowRun ends the run once all its records ended, the run failed when any step did not succeed
+func endWorkflowRun(runID uint) {
+	records, _ := cronjobRepo.ListRecord(cronjobRepo.WithByWorkflowRunID(runID), commonRepo.WithOrderBy("created_at asc"))
+	var failed []string
+	for _, record := range records {
+		if record.Status == constant.StatusWaiting {
+			return
+		}
+		if record.Status != constant.StatusSuccess {
+			job, _ := cronjobRepo.Get(commonRepo.WithByID(record.CronjobID))
+			failed = append(failed, fmt.Sprintf("step %s %s: %s", job.Name, record.Status, record.Message))
+		}
+	}
+	run, _ := cronjobRepo.GetWorkflowRun(commonRepo.WithByID(runID))
+	upMap := map[string]interface{}{
+		"status":   constant.StatusSuccess,
+		"message":  "",
+		"interval": time.Since(run.StartTime).Milliseconds(),
+	}
+	if len(failed) != 0 {
+		upMap["status"] = constant.StatusFailed
+		upMap["message"] = strings.Join(failed, "\n")
+	}
+	if err := cronjobRepo.UpdateWorkflowRun(runID, upMap); err != nil {
+		global.LOG.Errorf("update workflow run %d failed, err: %v", runID, err)
+	}
+}
+
+func (u *CronjobService) SearchWorkflowRuns(req dto.SearchWorkflowRun) (int64, interface{}, error) {
+	total, runs, err := cronjobRepo.PageWorkflowRuns(req.Page, req.PageSize, cronjobRepo.WithByJobID(int(req.CronjobID)))
+	if err != nil {
+		return 0, nil, err
+	}
+	jobs := make(map[uint]models.Cronjob)
+	loadJob := func(id uint) models.Cronjob {
+		if job, ok := jobs[id]; ok {
+			return job
+		}
+		job, _ := cronjobRepo.Get(commonRepo.WithByID(id))
+		jobs[id] = job
+		return job
+	}
+	var datas []dto.WorkflowRunInfo
+	for _, run := range runs {
+		item := dto.WorkflowRunInfo{
+			ID:        run.ID,
+			CronjobID: run.CronjobID,
+			Name:      loadJob(run.CronjobID).Name,
+			StartTime: run.StartTime.Format(constant.DateTimeLayout),
+			Interval:  int(run.Interval),
+			Status:    run.Status,
+			Message:   run.Message,
+		}
+		records, _ := cronjobRepo.ListRecord(cronjobRepo.WithByWorkflowRunID(run.ID), commonRepo.WithOrderBy("created_at asc"))
+		for _, record := range records {
+			job := loadJob(record.CronjobID)
+			item.Steps = append(item.Steps, dto.WorkflowStep{
+				RecordID:    record.ID,
+				CronjobID:   record.CronjobID,
+				Name:        job.Name,
+				Type:        job.Type,
+				TriggeredBy: record.TriggeredBy,
+				Attempt:     record.Attempt,
+				StartTime:   record.StartTime.Format(constant.DateTimeLayout),
+				Interval:    int(record.Interval),
+				Status:      record.Status,
+				Message:     record.Message,
+			})
+			if len(item.FailedStep) == 0 && record.Status != constant.StatusSuccess && record.Status != constant.StatusWaiting {
+				item.FailedStep = job.Name
+			}
+		}
+		datas = append(datas, item)
+	}
+	return total, datas, nil
+}
@@ -31,8 +31,41 @@ func (s *NotificationService) SendAlert(metricType string, currentValue float64,
 
 	// build alarm data
 	data := s.buildNotificationData(metricType, currentValue, durationSeconds)
+	s.post(data)
+}
+
+// SendBackupAlert 发送备份校验失败通知
+func (s *NotificationService) SendBackupAlert(name, detail string) {
+	if s.APIURL == "" {
+		global.LOG.Error("The notification API is not configured. Skipping alarm sending.")
+		return
+	}
+
+	s.post(models.NotificationData{
+		EventCode: models.EventCodeBackupCorrupt,
+		AlarmTime: time.Now().Format("2006-01-02 15:04:05"),
+		DevNumber: idGenerator.Next("BACKUP"),
+		DevType:   fmt.Sprintf("backup %s failed verification: %s", name, detail),
+	})
+}
+
+// SendCronjobAlert 发送计划任务执行结果通知
+func (s *NotificationService) SendCronjobAlert(eventCode, name, detail string) {
+	if s.APIURL == "" {
+		global.LOG.Error("The notification API is not configured. Skipping alarm sending.")
+		return
+	}
+
+	s.post(models.NotificationData{
+		EventCode: eventCode,
+		AlarmTime: time.Now().Format("2006-01-02 15:04:05"),
+		DevNumber: idGenerator.Next("CRONJOB"),
+		DevType:   fmt.Sprintf("cronjob %s %s", name, detail),
+	})
+}
 
-	// 异步发送防止阻塞
+// 异步发送防止阻塞
+func (s *NotificationService) post(data models.NotificationData) {
 	go func() {
 		jsonData, _ := json.Marshal(data)
 		resp, err := http.Post(s.APIURL, "application/json", bytes.NewBuffer(jsonData))
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"LinuxOnM/internal/api/dto"
+	"LinuxOnM/internal/buserr"
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/global"
+	"LinuxOnM/internal/utils/copier"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type SnapshotService struct{}
+
+type ISnapshotService interface {
+	SearchWithPage(req dto.SearchWithPage) (int64, interface{}, error)
+	SnapshotCreate(req dto.SnapshotCreate) error
+	LoadSnapshotStatus(id uint) (*dto.SnapshotStatus, error)
+	UpdateDescription(req dto.UpdateDescription) error
+	Delete(req dto.SnapshotBatchDelete) error
+
+	SnapshotRecover(req dto.SnapshotRecover) error
+	SnapshotRollback(req dto.SnapshotRecover) error
+}
+
+func NewISnapshotService() ISnapshotService {
+	return &SnapshotService{}
+}
+
+func (u *SnapshotService) SearchWithPage(req dto.SearchWithPage) (int64, interface{}, error) {
+	total, snaps, err := snapshotRepo.Page(req.Page, req.PageSize, commonRepo.WithLikeName(req.Info), commonRepo.WithOrderBy("created_at desc"))
+	if err != nil {
+		return 0, nil, err
+	}
+	var datas []dto.SnapshotInfo
+	for _, snap := range snaps {
+		var item dto.SnapshotInfo
+		if err := copier.Copy(&item, &snap); err != nil {
+			return 0, nil, errors.WithMessage(constant.ErrStructTransform, err.Error())
+		}
+		datas = append(datas, item)
+	}
+	return total, datas, nil
+}
+
+// SnapshotCreate creates the snapshot record and returns, the snapshot is taken in the background
+// and its progress can be followed with LoadSnapshotStatus
+func (u *SnapshotService) SnapshotCreate(req dto.SnapshotCreate) error {
+	snap, err := newSnapshot(req, time.Now())
+	if err != nil {
+		return err
+	}
+	go func() {
+		if _, err := handleSnapshot(context.Background(), snap, "", nil); err != nil {
+			global.LOG.Errorf("create snapshot %s failed, err: %v", snap.Name, err)
+		}
+	}()
+	return nil
+}
+
+func (u *SnapshotService) LoadSnapshotStatus(id uint) (*dto.SnapshotStatus, error) {
+	status, err := snapshotRepo.GetStatus(id)
+	if err != nil {
+		return nil, err
+	}
+	var data dto.SnapshotStatus
+	if err := copier.Copy(&data, &status); err != nil {
+		return nil, errors.WithMessage(constant.ErrStructTransform, err.Error())
+	}
+	return &data, nil
+}
+
+func (u *SnapshotService) UpdateDescription(req dto.UpdateDescription) error {
+	snap, _ := snapshotRepo.Get(commonRepo.WithByID(req.ID))
+	if snap.ID == 0 {
+		return constant.ErrRecordNotFound
+	}
+	return snapshotRepo.Update(snap.ID, map[string]interface{}{"description": req.Description})
+}
+
+func (u *SnapshotService) Delete(req dto.SnapshotBatchDelete) error {
+	snaps, _ := snapshotRepo.GetList(commonRepo.WithIdsIn(req.Ids))
+	for _, snap := range snaps {
+		if snap.Status == constant.StatusRunning {
+			return buserr.WithName(constant.ErrSnapshotRunning, snap.Name)
+		}
+	}
+	for _, snap := range snaps {
+		if req.DeleteWithFile {
+			accountMap, err := loadClientMap(snap.From)
+			if err != nil {
+				return err
+			}
+			for _, account := range strings.Split(snap.From, ",") {
+				item, ok := accountMap[account]
+				if !ok {
+					continue
+				}
+				if _, err := item.client.Delete(path.Join(item.backupPath, snapshotDir, snap.Name+".tar.gz")); err != nil {
+					global.LOG.Errorf("delete snapshot %s from %s failed, err: %v", snap.Name, account, err)
+				}
+			}
+		}
+		_ = os.RemoveAll(loadSnapshotOriginalDir(snap))
+		_ = snapshotRepo.DeleteStatus(snap.ID)
+		if err := snapshotRepo.Delete(commonRepo.WithByID(snap.ID)); err != nil {
+			return fmt.Errorf("delete snapshot %s failed, err: %v", snap.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"LinuxOnM/internal/api/dto"
+	"LinuxOnM/internal/buserr"
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/global"
+	"LinuxOnM/internal/models"
+	"LinuxOnM/internal/utils/common"
+	"LinuxOnM/internal/utils/files"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// A snapshot is packed from the tmp dir system_snapshot/<name>:
+//
+//	panel/              panel binary and systemd service
+//	snapshot.json       panel version and paths the snapshot was taken with
+//	db/                 consistent copies of the sqlite databases
+//	docker/daemon.json  docker daemon config
+//	app_data.tar.gz     compose projects and image builds below the data dir
+//	panel_data.tar.gz   the rest of the data dir
+//	backup_data.tar.gz  local backup account dir
+//
+// and uploaded as system_snapshot/<name>.tar.gz to every backup account of the snapshot.
+const (
+	snapshotDir       = "system_snapshot"
+	snapshotInfoFile  = "snapshot.json"
+	snapAppDataFile   = "app_data.tar.gz"
+	snapPanelDataFile = "panel_data.tar.gz"
+	snapBackupFile    = "backup_data.tar.gz"
+)
+
+var panelServicePath = path.Join("/etc/systemd/system", constant.PanelServiceName+".service")
+
+type snapshotInfo struct {
+	Name      string    `json:"name"`
+	Version   string    `json:"version"`
+	Arch      string    `json:"arch"`
+	BaseDir   string    `json:"baseDir"`
+	BackupDir string    `json:"backupDir"`
+	DbFile    string    `json:"dbFile"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type snapshotFile struct {
+	checksum string
+	size     int64
+}
+
+// newSnapshot saves the snapshot and its step status, only one snapshot is taken at a time
+func newSnapshot(req dto.SnapshotCreate, now time.Time) (models.Snapshot, error) {
+	running, _ := snapshotRepo.Get(commonRepo.WithByStatus(constant.StatusRunning))
+	if running.ID != 0 {
+		return models.Snapshot{}, buserr.WithName(constant.ErrSnapshotRunning, running.Name)
+	}
+	if !slices.Contains(strings.Split(req.From, ","), req.DefaultDownload) {
+		return models.Snapshot{}, constant.ErrInvalidParams
+	}
+	if _, err := loadClientMap(req.From); err != nil {
+		return models.Snapshot{}, err
+	}
+	snap := models.Snapshot{
+		Name:            fmt.Sprintf("snapshot_%s_%s_%s", global.CONF.System.Version, runtime.GOARCH, now.Format(constant.DateTimeSlimLayout)),
+		Description:     req.Description,
+		From:            req.From,
+		DefaultDownload: req.DefaultDownload,
+		Status:          constant.StatusRunning,
+		Version:         global.CONF.System.Version,
+	}
+	if err := snapshotRepo.Create(&snap); err != nil {
+		return snap, err
+	}
+	if err := snapshotRepo.CreateStatus(&models.SnapshotStatus{SnapID: snap.ID}); err != nil {
+		return snap, err
+	}
+	return snap, nil
+}
+
+// handleSnapshot runs the steps of the snapshot one after another and records the result of each
+// step on the snapshot status, the first failed step stops the snapshot. The snapshot also stops
+// when ctx is done, the steps packing and uploading the data are interrupted then
+func handleSnapshot(ctx context.Context, snap models.Snapshot, encryptKey string, taskLog *cronjobTaskLog) (snapshotFile, error) {
+	var file snapshotFile
+	status, err := snapshotRepo.GetStatus(snap.ID)
+	if err != nil {
+		return file, err
+	}
+	rootDir := path.Join(global.CONF.System.TmpDir, snapshotDir, snap.Name)
+	archivePath := rootDir + ".tar.gz"
+	defer os.RemoveAll(rootDir)
+	defer os.Remove(archivePath)
+	if err := os.MkdirAll(rootDir, os.ModePerm); err != nil {
+		return file, failSnapshot(snap, "", err)
+	}
+	ignore := loadSnapshotIgnore()
+
+	steps := []struct {
+		column string
+		handle func() error
+	}{
+		{column: "panel", handle: func() error { return snapPanel(path.Join(rootDir, "panel")) }},
+		{column: "panel_info", handle: func() error { return snapPanelInfo(snap, rootDir) }},
+		{column: "daemon_json", handle: func() error { return snapDaemonJson(path.Join(rootDir, "docker")) }},
+		{column: "app_data", handle: func() error { return snapAppData(ctx, rootDir, ignore) }},
+		{column: "panel_data", handle: func() error { return snapPanelData(ctx, rootDir, ignore) }},
+		{column: "backup_data", handle: func() error { return snapBackupData(ctx, rootDir, ignore) }},
+		{column: "compress", handle: func() error {
+			if err := (files.TarGzArchiver{}).CompressDir(ctx, rootDir, archivePath, "", nil); err != nil {
+				return err
+			}
+			checksum, size, err := loadFileManifest(archivePath)
+			if err != nil {
+				return err
+			}
+			file = snapshotFile{checksum: checksum, size: size}
+			return snapshotRepo.UpdateStatus(status.ID, map[string]interface{}{"size": common.FormatBytes(uint64(size))})
+		}},
+		{column: "upload", handle: func() error { return uploadSnapshot(ctx, snap, archivePath, encryptKey, taskLog) }},
+	}
+	for _, step := range steps {
+		if ctx.Err() != nil {
+			return file, failSnapshot(snap, step.column, ctx.Err())
+		}
+		taskLog.Printf("snapshot step %s", step.column)
+		_ = snapshotRepo.UpdateStatus(status.ID, map[string]interface{}{step.column: constant.StatusRunning})
+		if err := step.handle(); err != nil {
+			_ = snapshotRepo.UpdateStatus(status.ID, map[string]interface{}{step.column: constant.StatusFailed})
+			return file, failSnapshot(snap, step.column, err)
+		}
+		_ = snapshotRepo.UpdateStatus(status.ID, map[string]interface{}{step.column: constant.StatusSuccess})
+	}
+	if err := snapshotRepo.Update(snap.ID, map[string]interface{}{"status": constant.StatusSuccess, "message": ""}); err != nil {
+		return file, err
+	}
+	global.LOG.Infof("create snapshot %s successful", snap.Name)
+	return file, nil
+}
+
+func failSnapshot(snap models.Snapshot, step string, err error) error {
+	message := err.Error()
+	if len(step) != 0 {
+		message = fmt.Sprintf("%s: %v", step, err)
+	}
+	_ = snapshotRepo.Update(snap.ID, map[string]interface{}{"status": constant.StatusFailed, "message": message})
+	return fmt.Errorf("snapshot %s failed, %s", snap.Name, message)
+}
+
+func loadSnapshotIgnore() *files.IgnoreRules {
+	setting, _ := settingRepo.Get(settingRepo.WithByKey("SnapshotIgnore"))
+	return files.NewIgnoreRules(setting.Value)
+}
+
+// snapshotExclude matches the SnapshotIgnore rules against the absolute paths below sourceDir,
+// skipDirs are left out in any case
+func snapshotExclude(sourceDir string, ignore *files.IgnoreRules, skipDirs ...string) func(relPath string, isDir bool) bool {
+	return func(relPath string, isDir bool) bool {
+		itemPath := path.Join(sourceDir, relPath)
+		if isDir && slices.Contains(skipDirs, itemPath) {
+			return true
+		}
+		return ignore.Match(strings.TrimPrefix(itemPath, "/"), isDir)
+	}
+}
+
+func snapPanel(targetDir string) error {
+	if err := os.MkdirAll(targetDir, os.ModePerm); err != nil {
+		return err
+	}
+	binPath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if binPath, err = filepath.EvalSymlinks(binPath); err != nil {
+		return err
+	}
+	if err := common.CopyFile(binPath, path.Join(targetDir, path.Base(binPath))); err != nil {
+		return fmt.Errorf("copy panel binary failed, err: %v", err)
+	}
+	if _, err := os.Stat(panelServicePath); err == nil {
+		if err := common.CopyFile(panelServicePath, path.Join(targetDir, path.Base(panelServicePath))); err != nil {
+			return fmt.Errorf("copy panel service failed, err: %v", err)
+		}
+	}
+	return nil
+}
+
+// snapPanelInfo writes the snapshot info and copies the databases with VACUUM INTO,
+// the copies stay consistent while the panel keeps writing
+func snapPanelInfo(snap models.Snapshot, rootDir string) error {
+	info := snapshotInfo{
+		Name:      snap.Name,
+		Version:   global.CONF.System.Version,
+		Arch:      runtime.GOARCH,
+		BaseDir:   global.CONF.System.BaseDir,
+		BackupDir: loadLocalBackupDir(),
+		DbFile:    global.CONF.System.DbFile,
+		CreatedAt: time.Now(),
+	}
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path.Join(rootDir, snapshotInfoFile), data, 0600); err != nil {
+		return err
+	}
+
+	dbDir := path.Join(rootDir, "db")
+	if err := os.MkdirAll(dbDir, os.ModePerm); err != nil {
+		return err
+	}
+	for name, db := range map[string]*gorm.DB{global.CONF.System.DbFile: global.DB, "monitor.db": global.MonitorDB} {
+		if err := db.Exec("VACUUM INTO ?", path.Join(dbDir, name)).Error; err != nil {
+			return fmt.Errorf("copy database %s failed, err: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func snapDaemonJson(targetDir string) error {
+	if _, err := os.Stat(constant.DaemonJsonPath); err != nil {
+		return nil
+	}
+	if err := os.MkdirAll(targetDir, os.ModePerm); err != nil {
+		return err
+	}
+	return common.CopyFile(constant.DaemonJsonPath, path.Join(targetDir, path.Base(constant.DaemonJsonPath)))
+}
+
+func snapAppData(ctx context.Context, rootDir string, ignore *files.IgnoreRules) error {
+	sourceDir := path.Join(global.CONF.System.DataDir, "docker")
+	if _, err := os.Stat(sourceDir); err != nil {
+		return nil
+	}
+	return (files.TarGzArchiver{}).CompressDir(ctx, sourceDir, path.Join(rootDir, snapAppDataFile), "", snapshotExclude(sourceDir, ignore))
+}
+
+// snapPanelData packs the data dir without the parts other steps take care of, the live cache
+// and the tmp dir the snapshot itself is built in
+func snapPanelData(ctx context.Context, rootDir string, ignore *files.IgnoreRules) error {
+	dataDir := global.CONF.System.DataDir
+	skipDirs := []string{
+		global.CONF.System.DbPath,
+		path.Join(dataDir, "docker"),
+		global.CONF.System.Cache,
+		global.CONF.System.TmpDir,
+		global.CONF.System.Backup,
+		loadLocalBackupDir(),
+	}
+	return (files.TarGzArchiver{}).CompressDir(ctx, dataDir, path.Join(rootDir, snapPanelDataFile), "", snapshotExclude(dataDir, ignore, skipDirs...))
+}
+
+// snapBackupData packs the local backup account dir without the snapshots kept in it
+func snapBackupData(ctx context.Context, rootDir string, ignore *files.IgnoreRules) error {
+	backupDir := loadLocalBackupDir()
+	if len(backupDir) == 0 {
+		return nil
+	}
+	if _, err := os.Stat(backupDir); err != nil {
+		return nil
+	}
+	return (files.TarGzArchiver{}).CompressDir(ctx, backupDir, path.Join(rootDir, snapBackupFile), "", snapshotExclude(backupDir, ignore, path.Join(backupDir, snapshotDir)))
+}
+
+func loadLocalBackupDir() string {
+	account, _ := backupRepo.Get(commonRepo.WithByType(constant.Local))
+	varMap := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(account.Vars), &varMap); err != nil {
+		return ""
+	}
+	dir, _ := varMap["dir"].(string)
+	if len(dir) == 0 {
+		return ""
+	}
+	return path.Clean(dir)
+}
+
+func uploadSnapshot(ctx context.Context, snap models.Snapshot, src, encryptKey string, taskLog *cronjobTaskLog) error {
+	accountMap, err := loadClientMap(snap.From)
+	if err != nil {
+		return err
+	}
+	for _, account := range strings.Split(snap.From, ",") {
+		if len(account) == 0 {
+			continue
+		}
+		item, ok := accountMap[account]
+		if !ok {
+			return fmt.Errorf("load backup account %s failed", account)
+		}
+		if err := item.upload(ctx, src, path.Join(item.backupPath, snapshotDir, path.Base(src)), encryptKey, taskLog); err != nil {
+			return fmt.Errorf("upload %s to %s failed, err: %v", path.Base(src), account, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,400 @@
+package services
+
+import (
+	"LinuxOnM/internal/api/dto"
+	"LinuxOnM/internal/buserr"
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/global"
+	"LinuxOnM/internal/models"
+	"LinuxOnM/internal/utils/cmd"
+	"LinuxOnM/internal/utils/common"
+	"LinuxOnM/internal/utils/files"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Before a snapshot is recovered the current state is packed like a snapshot into the original
+// dir, the rollback restores it the same way the snapshot was restored. The original dir is kept
+// outside the data dir so the recover never touches it.
+func loadSnapshotOriginalDir(snap models.Snapshot) string {
+	return path.Join(global.CONF.System.BaseDir, "LinuxOnM_original", snap.Name)
+}
+
+type snapshotStep struct {
+	name   string
+	handle func() error
+}
+
+func (u *SnapshotService) SnapshotRecover(req dto.SnapshotRecover) error {
+	snap, _ := snapshotRepo.Get(commonRepo.WithByID(req.ID))
+	if snap.ID == 0 {
+		return constant.ErrRecordNotFound
+	}
+	if snap.Status != constant.StatusSuccess {
+		return buserr.WithName(constant.ErrSnapshotStatus, snap.Name)
+	}
+	if err := startSystemOperate("Recovering"); err != nil {
+		return err
+	}
+	_ = snapshotRepo.Update(snap.ID, map[string]interface{}{"recover_status": constant.StatusRunning, "recover_message": ""})
+	go func() {
+		defer func() { _ = settingRepo.Update("SystemStatus", "Free") }()
+		if err := handleSnapshotRecover(snap, req); err != nil {
+			global.LOG.Errorf("recover snapshot %s failed, err: %v", snap.Name, err)
+		}
+	}()
+	return nil
+}
+
+func (u *SnapshotService) SnapshotRollback(req dto.SnapshotRecover) error {
+	snap, _ := snapshotRepo.Get(commonRepo.WithByID(req.ID))
+	if snap.ID == 0 {
+		return constant.ErrRecordNotFound
+	}
+	originalDir := loadSnapshotOriginalDir(snap)
+	if _, err := os.Stat(path.Join(originalDir, snapshotInfoFile)); err != nil {
+		return buserr.WithName(constant.ErrSnapshotRollback, snap.Name)
+	}
+	if err := startSystemOperate("Rollbacking"); err != nil {
+		return err
+	}
+	_ = snapshotRepo.Update(snap.ID, map[string]interface{}{"rollback_status": constant.StatusRunning, "rollback_message": ""})
+	go func() {
+		defer func() { _ = settingRepo.Update("SystemStatus", "Free") }()
+		if err := handleSnapshotRollback(snap, originalDir); err != nil {
+			global.LOG.Errorf("rollback snapshot %s failed, err: %v", snap.Name, err)
+		}
+	}()
+	return nil
+}
+
+// startSystemOperate blocks the other apis with the system status until the operation is done
+func startSystemOperate(status string) error {
+	current, err := settingRepo.Get(settingRepo.WithByKey("SystemStatus"))
+	if err != nil {
+		return err
+	}
+	if current.Value != "Free" {
+		return buserr.WithName(constant.ErrSnapshotRunning, current.Value)
+	}
+	return settingRepo.Update("SystemStatus", status)
+}
+
+// handleSnapshotRecover prepares the snapshot and the rollback point and restores the components
+// one by one. A failed step is saved as InterruptStep, a recover which is not new resumes from it.
+func handleSnapshotRecover(snap models.Snapshot, req dto.SnapshotRecover) error {
+	rootDir := path.Join(global.CONF.System.TmpDir, snapshotDir, snap.Name)
+	archivePath := rootDir + ".tar.gz"
+	originalDir := loadSnapshotOriginalDir(snap)
+	resume := !req.IsNew && len(snap.InterruptStep) != 0
+	var info snapshotInfo
+
+	prepare := []snapshotStep{
+		{name: "download", handle: func() error {
+			if _, err := os.Stat(archivePath); err == nil && !req.ReDownload {
+				return nil
+			}
+			return downloadSnapshot(snap, archivePath)
+		}},
+		{name: "decompress", handle: func() error {
+			_ = os.RemoveAll(rootDir)
+			return files.NewTarGzArchiver().Extract(archivePath, path.Dir(rootDir), "")
+		}},
+		{name: "readjson", handle: func() error {
+			var err error
+			if info, err = loadSnapshotInfo(rootDir); err != nil {
+				return err
+			}
+			if info.Arch != runtime.GOARCH {
+				return buserr.WithDetail(constant.ErrSnapshotArch, fmt.Sprintf("%s != %s", info.Arch, runtime.GOARCH), nil)
+			}
+			return nil
+		}},
+		{name: "backup", handle: func() error {
+			// a resumed recover keeps the rollback point of its first attempt
+			if _, err := os.Stat(path.Join(originalDir, snapshotInfoFile)); err == nil && resume {
+				return nil
+			}
+			return backupSnapshotOriginal(snap, originalDir)
+		}},
+	}
+	// the prepare steps always run, the restore steps continue from the interrupted one
+	restore := loadSnapshotRestoreSteps(rootDir, &info)
+	if resume {
+		for i, step := range restore {
+			if step.name == snap.InterruptStep {
+				restore = restore[i:]
+				break
+			}
+		}
+	}
+	for _, step := range append(prepare, restore...) {
+		global.LOG.Infof("recover snapshot %s, step %s", snap.Name, step.name)
+		if err := step.handle(); err != nil {
+			_ = snapshotRepo.Update(snap.ID, map[string]interface{}{
+				"recover_status":  constant.StatusFailed,
+				"recover_message": fmt.Sprintf("%s: %v", step.name, err),
+				"interrupt_step":  step.name,
+			})
+			return err
+		}
+	}
+
+	_ = os.RemoveAll(rootDir)
+	vars := map[string]interface{}{
+		"recover_status":    constant.StatusSuccess,
+		"recover_message":   "",
+		"interrupt_step":    "",
+		"last_recovered_at": time.Now().Format(constant.DateTimeLayout),
+	}
+	_ = snapshotRepo.Update(snap.ID, vars)
+	// the running panel still writes into the replaced database, the result is saved into the restored one
+	updateRestoredSnapshot(snap.Name, vars)
+	global.LOG.Infof("recover snapshot %s successful, restart the panel", snap.Name)
+	restartPanel()
+	return nil
+}
+
+func handleSnapshotRollback(snap models.Snapshot, originalDir string) error {
+	info, err := loadSnapshotInfo(originalDir)
+	if err != nil {
+		_ = snapshotRepo.Update(snap.ID, map[string]interface{}{"rollback_status": constant.StatusFailed, "rollback_message": err.Error()})
+		return err
+	}
+	for _, step := range loadSnapshotRestoreSteps(originalDir, &info) {
+		global.LOG.Infof("rollback snapshot %s, step %s", snap.Name, step.name)
+		if err := step.handle(); err != nil {
+			_ = snapshotRepo.Update(snap.ID, map[string]interface{}{
+				"rollback_status":  constant.StatusFailed,
+				"rollback_message": fmt.Sprintf("%s: %v", step.name, err),
+			})
+			return err
+		}
+	}
+	vars := map[string]interface{}{
+		"rollback_status":    constant.StatusSuccess,
+		"rollback_message":   "",
+		"last_rollbacked_at": time.Now().Format(constant.DateTimeLayout),
+		"recover_status":     "",
+		"interrupt_step":     "",
+	}
+	_ = snapshotRepo.Update(snap.ID, vars)
+	updateRestoredSnapshot(snap.Name, vars)
+	global.LOG.Infof("rollback snapshot %s successful, restart the panel", snap.Name)
+	restartPanel()
+	return nil
+}
+
+// loadSnapshotRestoreSteps restores a dir with the snapshot layout, the database and the panel
+// binary come last because the panel has to be restarted once they are replaced.
+//
+// The archives are extracted over the live dirs and merged with them: files of the snapshot replace
+// the current ones, files created after the snapshot are kept. Deletions are not synced on purpose,
+// the archives leave out the ignored paths and the dirs other steps restore, and panel_data is
+// extracted into the parent of the data dir, so a file missing from an archive is not necessarily stale.
+func loadSnapshotRestoreSteps(rootDir string, info *snapshotInfo) []snapshotStep {
+	return []snapshotStep{
+		{name: "daemon_json", handle: func() error { return recoverDaemonJson(rootDir) }},
+		{name: "app_data", handle: func() error {
+			return recoverArchive(path.Join(rootDir, snapAppDataFile), global.CONF.System.DataDir)
+		}},
+		{name: "panel_data", handle: func() error {
+			return recoverArchive(path.Join(rootDir, snapPanelDataFile), path.Dir(global.CONF.System.DataDir))
+		}},
+		{name: "backup_data", handle: func() error {
+			if len(info.BackupDir) == 0 {
+				return nil
+			}
+			return recoverArchive(path.Join(rootDir, snapBackupFile), path.Dir(info.BackupDir))
+		}},
+		{name: "panel_db", handle: func() error { return recoverPanelDB(rootDir) }},
+		{name: "panel", handle: func() error { return recoverPanel(rootDir) }},
+	}
+}
+
+func loadSnapshotInfo(rootDir string) (snapshotInfo, error) {
+	var info snapshotInfo
+	data, err := os.ReadFile(path.Join(rootDir, snapshotInfoFile))
+	if err != nil {
+		return info, err
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return info, err
+	}
+	return info, nil
+}
+
+// downloadSnapshot fetches the archive from the default download account first, cronjob
+// snapshots are decrypted with the key of their cronjob
+func downloadSnapshot(snap models.Snapshot, targetPath string) error {
+	cronjobKey := ""
+	record, _ := backupRepo.GetRecord(backupRepo.WithByType("snapshot"), backupRepo.WithByFileName(path.Base(targetPath)))
+	if record.CronjobID != 0 {
+		cronjob, _ := cronjobRepo.Get(commonRepo.WithByID(record.CronjobID))
+		cronjobKey = loadCronjobEncryptKey(cronjob)
+	}
+	accounts := []string{snap.DefaultDownload}
+	for _, account := range strings.Split(snap.From, ",") {
+		if len(account) != 0 && !slices.Contains(accounts, account) {
+			accounts = append(accounts, account)
+		}
+	}
+	for _, account := range accounts {
+		accountMap, err := loadClientMap(account)
+		if err != nil {
+			global.LOG.Errorf("load backup account %s failed, err: %v", account, err)
+			continue
+		}
+		item, ok := accountMap[account]
+		if !ok {
+			continue
+		}
+		srcPath := path.Join(item.backupPath, snapshotDir, path.Base(targetPath))
+		if exist, _ := item.client.Exist(srcPath); !exist {
+			continue
+		}
+		return item.download(context.Background(), srcPath, targetPath, cronjobKey)
+	}
+	return buserr.WithName(constant.ErrBackupFileMissing, path.Base(targetPath))
+}
+
+// backupSnapshotOriginal packs the current state with the snapshot steps, without uploading it
+func backupSnapshotOriginal(snap models.Snapshot, originalDir string) error {
+	_ = os.RemoveAll(originalDir)
+	if err := os.MkdirAll(originalDir, os.ModePerm); err != nil {
+		return err
+	}
+	ignore := loadSnapshotIgnore()
+	if err := snapPanel(path.Join(originalDir, "panel")); err != nil {
+		return err
+	}
+	if err := snapDaemonJson(path.Join(originalDir, "docker")); err != nil {
+		return err
+	}
+	if err := snapAppData(context.Background(), originalDir, ignore); err != nil {
+		return err
+	}
+	if err := snapPanelData(context.Background(), originalDir, ignore); err != nil {
+		return err
+	}
+	if err := snapBackupData(context.Background(), originalDir, ignore); err != nil {
+		return err
+	}
+	// the info file is written last, the rollback checks it to know the rollback point is complete
+	return snapPanelInfo(snap, originalDir)
+}
+
+func recoverDaemonJson(rootDir string) error {
+	src := path.Join(rootDir, "docker", path.Base(constant.DaemonJsonPath))
+	if _, err := os.Stat(src); err != nil {
+		return nil
+	}
+	if err := common.CopyFile(src, constant.DaemonJsonPath); err != nil {
+		return err
+	}
+	if cmd.Which("docker") {
+		if stdout, err := cmd.Exec("systemctl restart docker"); err != nil {
+			return fmt.Errorf("restart docker failed, err: %s", stdout)
+		}
+	}
+	return nil
+}
+
+// recoverArchive extracts the archive over dstDir, files which are not in the archive are kept
+func recoverArchive(filePath, dstDir string) error {
+	if _, err := os.Stat(filePath); err != nil {
+		return nil
+	}
+	if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+		return err
+	}
+	return files.NewTarGzArchiver().Extract(filePath, dstDir, "")
+}
+
+// recoverPanelDB puts the database copies over the live files with CopyFile, which writes a tmp file and
+// renames it over the target. The stale wal files are removed so sqlite does not replay them on the restored databases.
+func recoverPanelDB(rootDir string) error {
+	dbDir := path.Join(rootDir, "db")
+	entries, err := os.ReadDir(dbDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		target := path.Join(global.CONF.System.DbPath, entry.Name())
+		if err := common.CopyFile(path.Join(dbDir, entry.Name()), target); err != nil {
+			return err
+		}
+		_ = os.Remove(target + "-wal")
+		_ = os.Remove(target + "-shm")
+	}
+	return nil
+}
+
+// recoverPanel replaces the binary and the service, CopyFile renames a tmp file over the
+// target so the running binary is not written in place
+func recoverPanel(rootDir string) error {
+	panelDir := path.Join(rootDir, "panel")
+	binPath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if binPath, err = filepath.EvalSymlinks(binPath); err != nil {
+		return err
+	}
+	src := path.Join(panelDir, path.Base(binPath))
+	if _, err := os.Stat(src); err == nil {
+		if err := common.CopyFile(src, binPath); err != nil {
+			return err
+		}
+	}
+	serviceSrc := path.Join(panelDir, path.Base(panelServicePath))
+	if _, err := os.Stat(serviceSrc); err == nil {
+		if err := common.CopyFile(serviceSrc, panelServicePath); err != nil {
+			return err
+		}
+		_, _ = cmd.Exec("systemctl daemon-reload")
+	}
+	return nil
+}
+
+// updateRestoredSnapshot writes the result into the database file which was just restored,
+// global.DB keeps pointing at the replaced file until the panel restarts
+func updateRestoredSnapshot(name string, vars map[string]interface{}) {
+	db, err := gorm.Open(sqlite.Open(path.Join(global.CONF.System.DbPath, global.CONF.System.DbFile)), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		global.LOG.Errorf("open restored database failed, err: %v", err)
+		return
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	vars["status"] = constant.StatusSuccess
+	if err := db.Model(&models.Snapshot{}).Where("name = ?", name).Updates(vars).Error; err != nil {
+		global.LOG.Errorf("update snapshot %s in restored database failed, err: %v", name, err)
+	}
+}
+
+func restartPanel() {
+	go func() {
+		time.Sleep(1 * time.Second)
+		_, err := cmd.Execf("sudo systemctl restart %s.service", constant.PanelServiceName)
+		if err != nil {
+			global.LOG.Errorf("restart system after snapshot recover failed, err: %v", err)
+		}
+	}()
+}
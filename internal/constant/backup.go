@@ -5,4 +5,23 @@ const (
 	DisConnect   = "DISCONNECT"
 	VerifyFailed = "VERIFYFAILED"
 	Local        = "LOCAL"
+	S3           = "S3"
+	Sftp         = "SFTP"
+	WebDAV       = "WebDAV"
+)
+
+const (
+	BackupModeArchive = "archive"
+	BackupModeDedup   = "dedup"
+)
+
+const (
+	RecordVerified = "verified"
+	RecordCorrupt  = "corrupt"
+)
+
+const (
+	LogCleanKeep     = "keep"
+	LogCleanTruncate = "truncate"
+	LogCleanDelete   = "delete"
 )
@@ -10,6 +10,8 @@ const (
 const (
 	TypeSystem = "system"
 
+	PanelServiceName = "myapp_LinuxOnM"
+
 	DB DBContext = "db"
 )
 
@@ -0,0 +1,31 @@
+package constant
+
+const (
+	TriggerOnSuccess = "success"
+	TriggerOnFailed  = "failed"
+	TriggerOnAlways  = "always"
+)
+
+const (
+	NotifyPolicyDefault = "default"
+	NotifyPolicyCustom  = "custom"
+	NotifyPolicyNone    = "none"
+)
+
+const (
+	InterpreterBash   = "bash"
+	InterpreterSh     = "sh"
+	InterpreterPython = "python"
+)
+
+const (
+	ConcurrencyAllow   = "allow"
+	ConcurrencySkip    = "skip"
+	ConcurrencyQueue   = "queue"
+	ConcurrencyReplace = "replace"
+)
+
+const (
+	RetryBackoffFixed       = "fixed"
+	RetryBackoffExponential = "exponential"
+)
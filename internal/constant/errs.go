@@ -88,6 +88,44 @@ var (
 	ErrPgImagePull  = "ErrPgImagePull"
 )
 
+// backup
+var (
+	ErrBackupInUsed      = "ErrBackupInUsed"
+	ErrBackupLocalDelete = "ErrBackupLocalDelete"
+	ErrBackupCheck       = "ErrBackupCheck"
+	ErrBackupFileMissing = "ErrBackupFileMissing"
+	ErrBackupRecoverType = "ErrBackupRecoverType"
+
+	ErrBackupEncryptKey   = "ErrBackupEncryptKey"
+	ErrBackupDecryptKey   = "ErrBackupDecryptKey"
+	ErrBackupNotEncrypted = "ErrBackupNotEncrypted"
+	ErrBackupCorrupted    = "ErrBackupCorrupted"
+	ErrBackupVerify       = "ErrBackupVerify"
+	ErrTransferNotFound   = "ErrTransferNotFound"
+	ErrTransferCancelled  = "ErrTransferCancelled"
+)
+
+// snapshot
+var (
+	ErrSnapshotRunning  = "ErrSnapshotRunning"
+	ErrSnapshotStatus   = "ErrSnapshotStatus"
+	ErrSnapshotArch     = "ErrSnapshotArch"
+	ErrSnapshotRollback = "ErrSnapshotRollback"
+)
+
+// cronjob
+var (
+	ErrCronjobHttpParams  = "ErrCronjobHttpParams"
+	ErrCronjobShellParams = "ErrCronjobShellParams"
+	ErrCronjobNotRunning  = "ErrCronjobNotRunning"
+	ErrCronjobRetryCodes  = "ErrCronjobRetryCodes"
+	ErrCronjobDocument    = "ErrCronjobDocument"
+	ErrCronjobSpec        = "ErrCronjobSpec"
+
+	ErrCronjobTrigger      = "ErrCronjobTrigger"
+	ErrCronjobTriggerCycle = "ErrCronjobTriggerCycle"
+)
+
 // license
 var (
 	ErrLicenseInvalidType   = "LICENSE_INVALID_TYPE"
@@ -11,4 +11,8 @@ const (
 	StatusWaiting = "Waiting"
 	StatusNone    = "None"
 	StatusDisable = "Disable"
+
+	StatusCancelled = "cancelled"
+	StatusTimeout   = "timeout"
+	StatusSkipped   = "skipped"
 )
@@ -41,6 +41,7 @@ func Init() {
 	}
 
 	handleCronjobStatus()
+	handleSnapshotStatus()
 }
 
 func handleCronjobStatus() {
@@ -49,4 +50,32 @@ func handleCronjobStatus() {
 			"status":  constant.StatusFailed,
 			"message": "the task was interrupted due to the restart of the myapp_LinuxOnM service",
 		}).Error
+	_ = global.DB.Model(&models.CronjobHostRecord{}).Where("status = ?", constant.StatusWaiting).
+		Updates(map[string]interface{}{
+			"status":  constant.StatusFailed,
+			"message": "the task was interrupted due to the restart of the myapp_LinuxOnM service",
+		}).Error
+	_ = global.DB.Model(&models.WorkflowRun{}).Where("status = ?", constant.StatusRunning).
+		Updates(map[string]interface{}{
+			"status":  constant.StatusFailed,
+			"message": "the workflow was interrupted due to the restart of the myapp_LinuxOnM service",
+		}).Error
+}
+
+func handleSnapshotStatus() {
+	_ = global.DB.Model(&models.Snapshot{}).Where("status = ?", constant.StatusRunning).
+		Updates(map[string]interface{}{
+			"status":  constant.StatusFailed,
+			"message": "the snapshot was interrupted due to the restart of the myapp_LinuxOnM service",
+		}).Error
+	_ = global.DB.Model(&models.Snapshot{}).Where("recover_status = ?", constant.StatusRunning).
+		Updates(map[string]interface{}{
+			"recover_status":  constant.StatusFailed,
+			"recover_message": "the recover was interrupted due to the restart of the myapp_LinuxOnM service",
+		}).Error
+	_ = global.DB.Model(&models.Snapshot{}).Where("rollback_status = ?", constant.StatusRunning).
+		Updates(map[string]interface{}{
+			"rollback_status":  constant.StatusFailed,
+			"rollback_message": "the rollback was interrupted due to the restart of the myapp_LinuxOnM service",
+		}).Error
 }
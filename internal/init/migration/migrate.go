@@ -36,6 +36,22 @@ func Init() {
 		migrations.AddAlertSetting,
 		migrations.AddNotificationSetting,
 		migrations.AddTableStatus,
+		migrations.AddTableBackupAccount,
+		migrations.AddBackupEncryptKey,
+		migrations.AddBackupRecordManifest,
+		migrations.AddCronjobBackupMode,
+		migrations.AddCronjobRetentionPolicy,
+		migrations.AddTableSnapshot,
+		migrations.AddCronjobLogArchive,
+		migrations.AddCronjobHttpRequest,
+		migrations.AddCronjobTimeout,
+		migrations.AddCronjobWorkflow,
+		migrations.AddCronjobRetry,
+		migrations.AddCronjobNotification,
+		migrations.AddCronjobShellOptions,
+		migrations.AddCronjobHosts,
+		migrations.AddCronjobConcurrencyPolicy,
+		migrations.UpdateBackupCredentialType,
 	})
 	if err := m.Migrate(); err != nil {
 		global.LOG.Error(err)
@@ -0,0 +1,100 @@
+package migrations
+
+import (
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/global"
+	"LinuxOnM/internal/models"
+	"LinuxOnM/internal/utils/encrypt"
+	"encoding/json"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+var AddTableBackupAccount = &gormigrate.Migration{
+	ID: "20261018-add-table-backup-account",
+	Migrate: func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&models.BackupAccount{}, &models.BackupRecord{}); err != nil {
+			return err
+		}
+
+		var encryptSetting models.Setting
+		if err := tx.Where("key = ?", "EncryptKey").Find(&encryptSetting).Error; err != nil {
+			return err
+		}
+		global.CONF.System.EncryptKey = encryptSetting.Value
+
+		// accounts inserted by hand before this migration still carry plain text credentials
+		var accounts []models.BackupAccount
+		if err := tx.Where("1 = 1").Find(&accounts).Error; err != nil {
+			return err
+		}
+		for _, account := range accounts {
+			accessKey, err := encrypt.StringEncrypt(account.AccessKey)
+			if err != nil {
+				return err
+			}
+			credential, err := encrypt.StringEncrypt(account.Credential)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&models.BackupAccount{}).Where("id = ?", account.ID).Updates(map[string]interface{}{"access_key": accessKey, "credential": credential}).Error; err != nil {
+				return err
+			}
+		}
+
+		var local models.BackupAccount
+		if err := tx.Where("type = ?", constant.Local).Find(&local).Error; err != nil {
+			return err
+		}
+		if local.ID == 0 {
+			vars, _ := json.Marshal(map[string]interface{}{"dir": global.CONF.System.Backup})
+			if err := tx.Create(&models.BackupAccount{Type: constant.Local, Vars: string(vars)}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var AddBackupEncryptKey = &gormigrate.Migration{
+	ID: "20261018-add-backup-encrypt-key",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.BackupAccount{}, &models.Cronjob{})
+	},
+}
+
+var AddBackupRecordManifest = &gormigrate.Migration{
+	ID: "20261018-add-backup-record-manifest",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.BackupRecord{})
+	},
+}
+
+var AddCronjobBackupMode = &gormigrate.Migration{
+	ID: "20261018-add-cronjob-backup-mode",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.Cronjob{})
+	},
+}
+
+var AddCronjobRetentionPolicy = &gormigrate.Migration{
+	ID: "20261018-add-cronjob-retention-policy",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.Cronjob{})
+	},
+}
+
+var AddCronjobLogArchive = &gormigrate.Migration{
+	ID: "20261018-add-cronjob-log-archive",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.Cronjob{})
+	},
+}
+
+var UpdateBackupCredentialType = &gormigrate.Migration{
+	ID: "20261018-update-backup-credential-type",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.Migrator().AlterColumn(&models.BackupAccount{}, "Credential")
+	},
+}
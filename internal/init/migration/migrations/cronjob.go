@@ -12,3 +12,71 @@ var AddNewTableCronjob = &gormigrate.Migration{
 		return tx.AutoMigrate(&models.Cronjob{}, &models.JobRecords{})
 	},
 }
+
+var AddCronjobHttpRequest = &gormigrate.Migration{
+	ID: "20261018-add-cronjob-http-request",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.Cronjob{}, &models.JobRecords{})
+	},
+}
+
+var AddCronjobTimeout = &gormigrate.Migration{
+	ID: "20261018-add-cronjob-timeout",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.Cronjob{})
+	},
+}
+
+var AddCronjobWorkflow = &gormigrate.Migration{
+	ID: "20261018-add-cronjob-workflow",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.JobRecords{}, &models.CronjobTrigger{}, &models.WorkflowRun{})
+	},
+}
+
+var AddCronjobRetry = &gormigrate.Migration{
+	ID: "20261018-add-cronjob-retry",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.Cronjob{}, &models.JobRecords{})
+	},
+}
+
+var AddCronjobNotification = &gormigrate.Migration{
+	ID: "20261018-add-cronjob-notification",
+	Migrate: func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&models.Cronjob{}); err != nil {
+			return err
+		}
+		if err := tx.Create(&models.Setting{Key: "CronjobNotifyOnFailure", Value: "Enable"}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.Setting{Key: "CronjobNotifyOnSuccess", Value: "Disable"}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.Setting{Key: "CronjobNotifyOverDuration", Value: "0"}).Error; err != nil {
+			return err
+		}
+		return nil
+	},
+}
+
+var AddCronjobShellOptions = &gormigrate.Migration{
+	ID: "20261018-add-cronjob-shell-options",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.Cronjob{})
+	},
+}
+
+var AddCronjobHosts = &gormigrate.Migration{
+	ID: "20261018-add-cronjob-hosts",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.Cronjob{}, &models.CronjobHostRecord{})
+	},
+}
+
+var AddCronjobConcurrencyPolicy = &gormigrate.Migration{
+	ID: "20261018-add-cronjob-concurrency-policy",
+	Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.Cronjob{})
+	},
+}
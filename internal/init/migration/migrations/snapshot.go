@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"LinuxOnM/internal/models"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+var AddTableSnapshot = &gormigrate.Migration{
+	ID: "20261018-add-table-snapshot",
+	Migrate: func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&models.Snapshot{}, &models.SnapshotStatus{}); err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&models.Setting{}).Where("key = ?", "SnapshotIgnore").Count(&count).Error; err != nil {
+			return err
+		}
+		if count != 0 {
+			return nil
+		}
+		return tx.Create(&models.Setting{Key: "SnapshotIgnore", Value: "*.sock"}).Error
+	},
+}
@@ -1,13 +1,16 @@
 package models
 
+import "time"
+
 type BackupAccount struct {
 	BaseModel
 	Type       string `gorm:"type:varchar(64);unique;not null" json:"type"`
 	Bucket     string `gorm:"type:varchar(256)" json:"bucket"`
 	AccessKey  string `gorm:"type:varchar(256)" json:"accessKey"`
-	Credential string `gorm:"type:varchar(256)" json:"credential"`
+	Credential string `gorm:"type:longText" json:"credential"`
 	BackupPath string `gorm:"type:varchar(256)" json:"backupPath"`
 	Vars       string `gorm:"type:longText" json:"vars"`
+	EncryptKey string `gorm:"type:varchar(256)" json:"encryptKey"`
 }
 
 type BackupRecord struct {
@@ -21,4 +24,10 @@ type BackupRecord struct {
 	BackupType string `gorm:"type:varchar(256)" json:"backupType"`
 	FileDir    string `gorm:"type:varchar(256)" json:"fileDir"`
 	FileName   string `gorm:"type:varchar(256)" json:"fileName"`
+
+	Checksum      string    `gorm:"type:varchar(128)" json:"checksum"`
+	Size          int64     `gorm:"type:decimal" json:"size"`
+	VerifyStatus  string    `gorm:"type:varchar(64)" json:"verifyStatus"`
+	VerifyMessage string    `gorm:"longtext" json:"verifyMessage"`
+	VerifiedAt    time.Time `gorm:"type:datetime" json:"verifiedAt"`
 }
@@ -9,6 +9,20 @@ type Cronjob struct {
 	Type string `gorm:"type:varchar(64);not null" json:"type"`
 	Spec string `gorm:"type:varchar(64);not null" json:"spec"`
 
+	Timeout uint64 `gorm:"type:decimal" json:"timeout"`
+
+	ConcurrencyPolicy string `gorm:"type:varchar(64)" json:"concurrencyPolicy"`
+
+	RetryMaxAttempts uint64 `gorm:"type:decimal" json:"retryMaxAttempts"`
+	RetryBackoff     string `gorm:"type:varchar(64)" json:"retryBackoff"`
+	RetryDelay       uint64 `gorm:"type:decimal" json:"retryDelay"`
+	RetryExitCodes   string `gorm:"type:varchar(256)" json:"retryExitCodes"`
+
+	NotifyPolicy       string `gorm:"type:varchar(64)" json:"notifyPolicy"`
+	NotifyOnFailure    bool   `gorm:"type:varchar(64)" json:"notifyOnFailure"`
+	NotifyOnSuccess    bool   `gorm:"type:varchar(64)" json:"notifyOnSuccess"`
+	NotifyOverDuration uint64 `gorm:"type:decimal" json:"notifyOverDuration"`
+
 	Command        string `gorm:"type:varchar(64)" json:"command"`
 	ContainerName  string `gorm:"type:varchar(64)" json:"containerName"`
 	Script         string `gorm:"longtext" json:"script"`
@@ -16,6 +30,15 @@ type Cronjob struct {
 	SourceDir      string `gorm:"type:varchar(256)" json:"sourceDir"`
 	ExclusionRules string `gorm:"longtext" json:"exclusionRules"`
 
+	RunAsUser   string `gorm:"type:varchar(64)" json:"runAsUser"`
+	RunAsGroup  string `gorm:"type:varchar(64)" json:"runAsGroup"`
+	Workdir     string `gorm:"type:varchar(256)" json:"workdir"`
+	Interpreter string `gorm:"type:varchar(64)" json:"interpreter"`
+	Environment string `gorm:"longtext" json:"environment"`
+
+	HostIDs     string `gorm:"type:varchar(256)" json:"hostIDs"`
+	HostGroupID uint   `gorm:"type:decimal" json:"hostGroupID"`
+
 	// 已废弃
 	KeepLocal   bool   `gorm:"type:varchar(64)" json:"keepLocal"`
 	TargetDirID uint64 `gorm:"type:decimal" json:"targetDirID"`
@@ -23,11 +46,29 @@ type Cronjob struct {
 	BackupAccounts  string `gorm:"type:varchar(64)" json:"backupAccounts"`
 	DefaultDownload string `gorm:"type:varchar(64)" json:"defaultDownload"`
 	RetainCopies    uint64 `gorm:"type:decimal" json:"retainCopies"`
+	RetainDaily     uint64 `gorm:"type:decimal" json:"retainDaily"`
+	RetainWeekly    uint64 `gorm:"type:decimal" json:"retainWeekly"`
+	RetainMonthly   uint64 `gorm:"type:decimal" json:"retainMonthly"`
+	RetainYearly    uint64 `gorm:"type:decimal" json:"retainYearly"`
+	RetainMinAge    uint64 `gorm:"type:decimal" json:"retainMinAge"`
 
 	Status   string       `gorm:"type:varchar(64)" json:"status"`
 	EntryIDs string       `gorm:"type:varchar(64)" json:"entryIDs"`
 	Records  []JobRecords `json:"records"`
 	Secret   string       `gorm:"type:varchar(64)" json:"secret"`
+
+	EncryptKey string `gorm:"type:varchar(256)" json:"encryptKey"`
+	BackupMode string `gorm:"type:varchar(64)" json:"backupMode"`
+
+	LogCleanMode  string `gorm:"type:varchar(64)" json:"logCleanMode"`
+	LogContainers bool   `gorm:"type:varchar(64)" json:"logContainers"`
+
+	HttpMethod   string `gorm:"type:varchar(64)" json:"httpMethod"`
+	HttpHeaders  string `gorm:"longtext" json:"httpHeaders"`
+	HttpBody     string `gorm:"longtext" json:"httpBody"`
+	HttpTimeout  uint64 `gorm:"type:decimal" json:"httpTimeout"`
+	ExpectStatus string `gorm:"type:varchar(64)" json:"expectStatus"`
+	ExpectBody   string `gorm:"type:varchar(256)" json:"expectBody"`
 }
 
 type JobRecords struct {
@@ -41,4 +82,49 @@ type JobRecords struct {
 	File      string    `gorm:"type:varchar(256)" json:"file"`
 	Status    string    `gorm:"type:varchar(64)" json:"status"`
 	Message   string    `gorm:"longtext" json:"message"`
+
+	StatusCode int     `gorm:"type:decimal" json:"statusCode"`
+	Latency    float64 `gorm:"type:float" json:"latency"`
+	Excerpt    string  `gorm:"longtext" json:"excerpt"`
+
+	WorkflowRunID uint `gorm:"type:decimal" json:"workflowRunID"`
+	TriggeredBy   uint `gorm:"type:decimal" json:"triggeredBy"`
+
+	Attempt uint `gorm:"type:decimal" json:"attempt"`
+	RetryOf uint `gorm:"type:decimal" json:"retryOf"`
+}
+
+// CronjobTrigger starts the target job when the cronjob ends with the status of the condition
+type CronjobTrigger struct {
+	BaseModel
+
+	CronjobID uint   `gorm:"type:decimal;not null" json:"cronjobID"`
+	TargetID  uint   `gorm:"type:decimal;not null" json:"targetID"`
+	Condition string `gorm:"type:varchar(64);not null" json:"condition"`
+}
+
+// WorkflowRun groups the records of a cronjob with triggers and of the jobs it triggered
+type WorkflowRun struct {
+	BaseModel
+
+	CronjobID uint      `gorm:"type:decimal" json:"cronjobID"`
+	StartTime time.Time `gorm:"type:datetime" json:"startTime"`
+	Interval  float64   `gorm:"type:float" json:"interval"`
+	Status    string    `gorm:"type:varchar(64)" json:"status"`
+	Message   string    `gorm:"longtext" json:"message"`
+}
+
+// CronjobHostRecord is the result of a shell cronjob on one of the remote hosts it runs on, the
+// hosts of a run share the JobRecords of the run
+type CronjobHostRecord struct {
+	BaseModel
+
+	RecordID uint    `gorm:"type:decimal;not null" json:"recordID"`
+	HostID   uint    `gorm:"type:decimal;not null" json:"hostID"`
+	Name     string  `gorm:"type:varchar(64)" json:"name"`
+	Addr     string  `gorm:"type:varchar(16)" json:"addr"`
+	Interval float64 `gorm:"type:float" json:"interval"`
+	Records  string  `gorm:"longtext" json:"records"`
+	Status   string  `gorm:"type:varchar(64)" json:"status"`
+	Message  string  `gorm:"longtext" json:"message"`
 }
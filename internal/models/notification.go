@@ -38,5 +38,9 @@ func (g *AlarmIDGenerator) Next(metricType string) string {
 const (
 	EventCodeCPUHighUsage    = "OP000"
 	EventCodeMemoryHigeUsage = "OP111"
+	EventCodeBackupCorrupt   = "OP201"
+	EventCodeCronjobFailed   = "OP301"
+	EventCodeCronjobSucceed  = "OP302"
+	EventCodeCronjobSlow     = "OP303"
 	EventCodeUnknown         = "OP999"
 )
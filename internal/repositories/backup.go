@@ -10,12 +10,20 @@ import (
 type BackupRepo struct{}
 
 type IBackupRepo interface {
+	Get(opts ...DBOption) (models.BackupAccount, error)
 	List(opts ...DBOption) ([]models.BackupAccount, error)
+	Create(backup *models.BackupAccount) error
+	Update(id uint, vars map[string]interface{}) error
+	Delete(opts ...DBOption) error
+	GetRecord(opts ...DBOption) (models.BackupRecord, error)
+	CreateRecord(record *models.BackupRecord) error
 	ListRecord(opts ...DBOption) ([]models.BackupRecord, error)
+	PageRecord(page, size int, opts ...DBOption) (int64, []models.BackupRecord, error)
 	UpdateRecord(record *models.BackupRecord) error
 	WithByCronID(cronjobID uint) DBOption
 	WithByType(backupType string) DBOption
 	WithByDetailName(detailName string) DBOption
+	WithByFileName(fileName string) DBOption
 	DeleteRecord(ctx context.Context, opts ...DBOption) error
 }
 
@@ -23,6 +31,16 @@ func NewIBackupRepo() IBackupRepo {
 	return &BackupRepo{}
 }
 
+func (u *BackupRepo) Get(opts ...DBOption) (models.BackupAccount, error) {
+	var backup models.BackupAccount
+	db := global.DB
+	for _, opt := range opts {
+		db = opt(db)
+	}
+	err := db.First(&backup).Error
+	return backup, err
+}
+
 func (u *BackupRepo) List(opts ...DBOption) ([]models.BackupAccount, error) {
 	var ops []models.BackupAccount
 	db := global.DB.Model(&models.BackupAccount{})
@@ -33,12 +51,50 @@ func (u *BackupRepo) List(opts ...DBOption) ([]models.BackupAccount, error) {
 	return ops, err
 }
 
+func (u *BackupRepo) Create(backup *models.BackupAccount) error {
+	return global.DB.Create(backup).Error
+}
+
+func (u *BackupRepo) Update(id uint, vars map[string]interface{}) error {
+	return global.DB.Model(&models.BackupAccount{}).Where("id = ?", id).Updates(vars).Error
+}
+
+func (u *BackupRepo) Delete(opts ...DBOption) error {
+	db := global.DB
+	for _, opt := range opts {
+		db = opt(db)
+	}
+	return db.Delete(&models.BackupAccount{}).Error
+}
+
 func (u *BackupRepo) WithByCronID(cronjobID uint) DBOption {
 	return func(g *gorm.DB) *gorm.DB {
 		return g.Where("cronjob_id = ?", cronjobID)
 	}
 }
 
+func (u *BackupRepo) GetRecord(opts ...DBOption) (models.BackupRecord, error) {
+	var record models.BackupRecord
+	db := global.DB
+	for _, opt := range opts {
+		db = opt(db)
+	}
+	err := db.First(&record).Error
+	return record, err
+}
+
+func (u *BackupRepo) PageRecord(page, size int, opts ...DBOption) (int64, []models.BackupRecord, error) {
+	var records []models.BackupRecord
+	db := global.DB.Model(&models.BackupRecord{})
+	for _, opt := range opts {
+		db = opt(db)
+	}
+	count := int64(0)
+	db = db.Count(&count)
+	err := db.Order("created_at desc").Limit(size).Offset(size * (page - 1)).Find(&records).Error
+	return count, records, err
+}
+
 func (u *BackupRepo) ListRecord(opts ...DBOption) ([]models.BackupRecord, error) {
 	var users []models.BackupRecord
 	db := global.DB.Model(&models.BackupRecord{})
@@ -49,6 +105,10 @@ func (u *BackupRepo) ListRecord(opts ...DBOption) ([]models.BackupRecord, error)
 	return users, err
 }
 
+func (u *BackupRepo) CreateRecord(record *models.BackupRecord) error {
+	return global.DB.Create(record).Error
+}
+
 func (u *BackupRepo) UpdateRecord(record *models.BackupRecord) error {
 	return global.DB.Save(record).Error
 }
@@ -71,6 +131,15 @@ func (u *BackupRepo) WithByDetailName(detailName string) DBOption {
 	}
 }
 
+func (u *BackupRepo) WithByFileName(fileName string) DBOption {
+	return func(g *gorm.DB) *gorm.DB {
+		if len(fileName) == 0 {
+			return g
+		}
+		return g.Where("file_name = ?", fileName)
+	}
+}
+
 func (u *BackupRepo) DeleteRecord(ctx context.Context, opts ...DBOption) error {
 	return getTx(ctx, opts...).Delete(&models.BackupRecord{}).Error
 }
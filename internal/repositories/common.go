@@ -110,7 +110,7 @@ func (c *CommonRepository) WithByStartDate(startTime time.Time) DBOption {
 
 func (c *CommonRepository) WithByFrom(from string) DBOption {
 	return func(db *gorm.DB) *gorm.DB {
-		return db.Where("from = ?", from)
+		return db.Where("`from` = ?", from)
 	}
 }
 
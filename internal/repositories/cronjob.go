@@ -13,6 +13,7 @@ type CronjobRepo struct{}
 type ICronjobRepo interface {
 	Get(opts ...DBOption) (models.Cronjob, error)
 	GetRecord(opts ...DBOption) (models.JobRecords, error)
+	List(opts ...DBOption) ([]models.Cronjob, error)
 	Create(cronjob *models.Cronjob) error
 	Update(id uint, vars map[string]interface{}) error
 	Page(limit, offset int, opts ...DBOption) (int64, []models.Cronjob, error)
@@ -25,6 +26,24 @@ type ICronjobRepo interface {
 	DeleteRecord(opts ...DBOption) error
 	EndRecords(record models.JobRecords, status, message, records string)
 	PageRecords(page, size int, opts ...DBOption) (int64, []models.JobRecords, error)
+
+	WithByTargetID(id uint) DBOption
+	WithByWorkflowRunID(id uint) DBOption
+	ListTriggers(opts ...DBOption) ([]models.CronjobTrigger, error)
+	SaveTriggers(cronjobID uint, triggers []models.CronjobTrigger) error
+	DeleteTriggers(opts ...DBOption) error
+	CreateWorkflowRun(run *models.WorkflowRun) error
+	GetWorkflowRun(opts ...DBOption) (models.WorkflowRun, error)
+	UpdateWorkflowRun(id uint, vars map[string]interface{}) error
+	DeleteWorkflowRun(opts ...DBOption) error
+	PageWorkflowRuns(page, size int, opts ...DBOption) (int64, []models.WorkflowRun, error)
+
+	WithByRecordID(id uint) DBOption
+	CreateHostRecord(record *models.CronjobHostRecord) error
+	GetHostRecord(opts ...DBOption) (models.CronjobHostRecord, error)
+	ListHostRecords(opts ...DBOption) ([]models.CronjobHostRecord, error)
+	UpdateHostRecord(id uint, vars map[string]interface{}) error
+	DeleteHostRecords(opts ...DBOption) error
 }
 
 func NewICronjobRepo() ICronjobRepo {
@@ -51,6 +70,16 @@ func (u *CronjobRepo) GetRecord(opts ...DBOption) (models.JobRecords, error) {
 	return record, err
 }
 
+func (u *CronjobRepo) List(opts ...DBOption) ([]models.Cronjob, error) {
+	var cronjobs []models.Cronjob
+	db := global.DB.Model(&models.Cronjob{})
+	for _, opt := range opts {
+		db = opt(db)
+	}
+	err := db.Find(&cronjobs).Error
+	return cronjobs, err
+}
+
 func (u *CronjobRepo) Create(cronjob *models.Cronjob) error {
 	return global.DB.Create(cronjob).Error
 }
@@ -148,3 +177,126 @@ func (u *CronjobRepo) PageRecords(page, size int, opts ...DBOption) (int64, []mo
 	err := db.Order("created_at desc").Limit(size).Offset(size * (page - 1)).Find(&cronjobs).Error
 	return count, cronjobs, err
 }
+
+func (c *CronjobRepo) WithByTargetID(id uint) DBOption {
+	return func(g *gorm.DB) *gorm.DB {
+		return g.Where("target_id = ?", id)
+	}
+}
+
+func (c *CronjobRepo) WithByWorkflowRunID(id uint) DBOption {
+	return func(g *gorm.DB) *gorm.DB {
+		return g.Where("workflow_run_id = ?", id)
+	}
+}
+
+func (u *CronjobRepo) ListTriggers(opts ...DBOption) ([]models.CronjobTrigger, error) {
+	var triggers []models.CronjobTrigger
+	db := global.DB.Model(&models.CronjobTrigger{})
+	for _, opt := range opts {
+		db = opt(db)
+	}
+	err := db.Find(&triggers).Error
+	return triggers, err
+}
+
+// SaveTriggers replaces the triggers of the cronjob
+func (u *CronjobRepo) SaveTriggers(cronjobID uint, triggers []models.CronjobTrigger) error {
+	return global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("cronjob_id = ?", cronjobID).Delete(&models.CronjobTrigger{}).Error; err != nil {
+			return err
+		}
+		if len(triggers) == 0 {
+			return nil
+		}
+		return tx.Create(&triggers).Error
+	})
+}
+
+func (u *CronjobRepo) DeleteTriggers(opts ...DBOption) error {
+	db := global.DB
+	for _, opt := range opts {
+		db = opt(db)
+	}
+	return db.Delete(&models.CronjobTrigger{}).Error
+}
+
+func (u *CronjobRepo) CreateWorkflowRun(run *models.WorkflowRun) error {
+	return global.DB.Create(run).Error
+}
+
+func (u *CronjobRepo) GetWorkflowRun(opts ...DBOption) (models.WorkflowRun, error) {
+	var run models.WorkflowRun
+	db := global.DB
+	for _, opt := range opts {
+		db = opt(db)
+	}
+	err := db.First(&run).Error
+	return run, err
+}
+
+func (u *CronjobRepo) UpdateWorkflowRun(id uint, vars map[string]interface{}) error {
+	return global.DB.Model(&models.WorkflowRun{}).Where("id = ?", id).Updates(vars).Error
+}
+
+func (u *CronjobRepo) DeleteWorkflowRun(opts ...DBOption) error {
+	db := global.DB
+	for _, opt := range opts {
+		db = opt(db)
+	}
+	return db.Delete(&models.WorkflowRun{}).Error
+}
+
+func (u *CronjobRepo) PageWorkflowRuns(page, size int, opts ...DBOption) (int64, []models.WorkflowRun, error) {
+	var runs []models.WorkflowRun
+	db := global.DB.Model(&models.WorkflowRun{})
+	for _, opt := range opts {
+		db = opt(db)
+	}
+	count := int64(0)
+	db = db.Count(&count)
+	err := db.Order("created_at desc").Limit(size).Offset(size * (page - 1)).Find(&runs).Error
+	return count, runs, err
+}
+
+func (c *CronjobRepo) WithByRecordID(id uint) DBOption {
+	return func(g *gorm.DB) *gorm.DB {
+		return g.Where("record_id = ?", id)
+	}
+}
+
+func (u *CronjobRepo) CreateHostRecord(record *models.CronjobHostRecord) error {
+	return global.DB.Create(record).Error
+}
+
+func (u *CronjobRepo) GetHostRecord(opts ...DBOption) (models.CronjobHostRecord, error) {
+	var record models.CronjobHostRecord
+	db := global.DB
+	for _, opt := range opts {
+		db = opt(db)
+	}
+	err := db.First(&record).Error
+	return record, err
+}
+
+func (u *CronjobRepo) ListHostRecords(opts ...DBOption) ([]models.CronjobHostRecord, error) {
+	var records []models.CronjobHostRecord
+	db := global.DB.Model(&models.CronjobHostRecord{})
+	for _, opt := range opts {
+		db = opt(db)
+	}
+	err := db.Find(&records).Error
+	return records, err
+}
+
+func (u *CronjobRepo) UpdateHostRecord(id uint, vars map[string]interface{}) error {
+	return global.DB.Model(&models.CronjobHostRecord{}).Where("id = ?", id).Updates(vars).Error
+}
+
+func (u *CronjobRepo) DeleteHostRecords(opts ...DBOption) error {
+	db := global.DB
+	for _, opt := range opts {
+		db = opt(db)
+	}
+	return db.Delete(&models.CronjobHostRecord{}).Error
+}
@@ -11,6 +11,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -80,16 +81,40 @@ func SudoHandleCmd() string {
 }
 
 func ExecCronjobWithTimeOut(cmdStr, workdir, outPath string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := ExecCronjobWithContext(ctx, cmdStr, workdir, outPath); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return buserr.New(constant.ErrCmdTimeout)
+		}
+		return err
+	}
+	return nil
+}
+
+// ExecCronjobWithContext runs the script in its own process group, the whole group is killed
+// when the context is done so that children of the script do not outlive it
+func ExecCronjobWithContext(ctx context.Context, cmdStr, workdir, outPath string) error {
+	cmd := exec.Command("bash", "-c", cmdStr)
+	cmd.Dir = workdir
+	return RunCronjobWithContext(ctx, cmd, outPath)
+}
+
+// RunCronjobWithContext runs a prepared command like ExecCronjobWithContext, the credential,
+// the environment and the working directory set on the command are kept
+func RunCronjobWithContext(ctx context.Context, cmd *exec.Cmd, outPath string) error {
 	file, err := os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE, 0666)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	cmd := exec.Command("bash", "-c", cmdStr)
-	cmd.Dir = workdir
 	cmd.Stdout = file
 	cmd.Stderr = file
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
 	if err := cmd.Start(); err != nil {
 		return err
 	}
@@ -97,11 +122,11 @@ func ExecCronjobWithTimeOut(cmdStr, workdir, outPath string, timeout time.Durati
 	go func() {
 		done <- cmd.Wait()
 	}()
-	after := time.After(timeout)
 	select {
-	case <-after:
-		_ = cmd.Process.Kill()
-		return buserr.New(constant.ErrCmdTimeout)
+	case <-ctx.Done():
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		return ctx.Err()
 	case err := <-done:
 		if err != nil {
 			return err
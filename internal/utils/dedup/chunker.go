@@ -0,0 +1,58 @@
+package dedup
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Files are split with a gear based content defined chunker, the cut points only depend on the
+// bytes around them so an insert in the middle of a file keeps the rest of its chunks unchanged.
+const (
+	minChunkSize = 512 * 1024
+	maxChunkSize = 8 * 1024 * 1024
+	chunkMask    = 1<<20 - 1
+)
+
+var gearTable = loadGearTable()
+
+func loadGearTable() [256]uint64 {
+	var table [256]uint64
+	for i := range table {
+		sum := sha256.Sum256([]byte{byte(i)})
+		table[i] = binary.BigEndian.Uint64(sum[:8])
+	}
+	return table
+}
+
+type chunker struct {
+	reader *bufio.Reader
+	buf    []byte
+}
+
+func newChunker(reader io.Reader) *chunker {
+	return &chunker{reader: bufio.NewReaderSize(reader, 1024*1024), buf: make([]byte, 0, maxChunkSize)}
+}
+
+// next returns the next chunk or io.EOF once the reader is drained, the returned
+// slice is reused by the following call
+func (c *chunker) next() ([]byte, error) {
+	c.buf = c.buf[:0]
+	var hash uint64
+	for {
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(c.buf) != 0 {
+				return c.buf, nil
+			}
+			return nil, err
+		}
+		c.buf = append(c.buf, b)
+		hash = hash<<1 + gearTable[b]
+		if (len(c.buf) >= minChunkSize && hash&chunkMask == 0) || len(c.buf) >= maxChunkSize {
+			return c.buf, nil
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package dedup
+
+import (
+	"LinuxOnM/internal/buserr"
+	"LinuxOnM/internal/constant"
+	"LinuxOnM/internal/utils/encrypt"
+	"LinuxOnM/internal/utils/storage_client"
+	"bytes"
+	"compress/gzip"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+)
+
+// A repository is stored below its dir on the backup account:
+//
+//	config                  version and encryption parameters
+//	chunks/<id[:2]>/<id>    gzip compressed (and encrypted) file chunks
+//	snapshots/<name>        gzip compressed (and encrypted) json index of one backup run
+const (
+	configObject = "config"
+	chunksDir    = "chunks"
+	snapshotsDir = "snapshots"
+	repoVersion  = 1
+)
+
+type repoConfig struct {
+	Version   int    `json:"version"`
+	Encrypted bool   `json:"encrypted"`
+	Salt      string `json:"salt"`
+	Check     string `json:"check"`
+}
+
+type Repository struct {
+	client storage_client.StorageClient
+	dir    string
+	tmpDir string
+	aead   cipher.AEAD
+	idKey  []byte
+}
+
+// repoLocks holds a lock per repository dir, a backup uploads its chunks before its snapshot refers to
+// them so a prune has to wait for the running backups of the repository. Repositories with the same dir
+// on different accounts share the lock, which only serializes them more than needed.
+var repoLocks sync.Map
+
+func (r *Repository) lock() *sync.RWMutex {
+	item, _ := repoLocks.LoadOrStore(r.dir, &sync.RWMutex{})
+	return item.(*sync.RWMutex)
+}
+
+// Open loads the repository stored under dir and initializes it on first use. A passphrase turns on
+// encryption for a new repository and has to match the one an encrypted repository was created with.
+func Open(client storage_client.StorageClient, dir, tmpDir, passphrase string) (*Repository, error) {
+	if err := os.MkdirAll(tmpDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	repoTmpDir, err := os.MkdirTemp(tmpDir, "dedup_")
+	if err != nil {
+		return nil, err
+	}
+	repo := &Repository{client: client, dir: dir, tmpDir: repoTmpDir}
+	if err := repo.loadConfig(passphrase); err != nil {
+		repo.Close()
+		return nil, err
+	}
+	return repo, nil
+}
+
+// Close removes the local tmp files of the repository
+func (r *Repository) Close() {
+	_ = os.RemoveAll(r.tmpDir)
+}
+
+func (r *Repository) loadConfig(passphrase string) error {
+	var config repoConfig
+	exist, _ := r.client.Exist(path.Join(r.dir, configObject))
+	if exist {
+		data, err := r.readObject(configObject)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return fmt.Errorf("load dedup repository config failed, err: %v", err)
+		}
+	} else {
+		config.Version = repoVersion
+		if len(passphrase) != 0 {
+			salt := make([]byte, 16)
+			if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+				return err
+			}
+			config.Encrypted = true
+			config.Salt = hex.EncodeToString(salt)
+		}
+	}
+
+	if !config.Encrypted {
+		if len(passphrase) != 0 {
+			return buserr.WithDetail(constant.ErrBackupEncryptKey, "the dedup repository was created without encryption", nil)
+		}
+		if !exist {
+			return r.writeConfig(config)
+		}
+		return nil
+	}
+	if len(passphrase) == 0 {
+		return buserr.WithDetail(constant.ErrBackupEncryptKey, "the dedup repository is encrypted but no passphrase is configured", nil)
+	}
+	salt, err := hex.DecodeString(config.Salt)
+	if err != nil {
+		return err
+	}
+	if r.aead, r.idKey, err = encrypt.DeriveCipher(passphrase, salt); err != nil {
+		return err
+	}
+	check := hex.EncodeToString(r.hash([]byte(configObject))[:16])
+	if !exist {
+		config.Check = check
+		return r.writeConfig(config)
+	}
+	if check != config.Check {
+		return buserr.WithDetail(constant.ErrBackupDecryptKey, "the passphrase does not match the one used to create the dedup repository", nil)
+	}
+	return nil
+}
+
+func (r *Repository) writeConfig(config repoConfig) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return r.writeObject(configObject, data)
+}
+
+// hash returns the chunk id, keyed for encrypted repositories so ids do not leak the content
+func (r *Repository) hash(data []byte) []byte {
+	if r.idKey == nil {
+		sum := sha256.Sum256(data)
+		return sum[:]
+	}
+	mac := hmac.New(sha256.New, r.idKey)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func (r *Repository) chunkID(data []byte) string {
+	return hex.EncodeToString(r.hash(data))
+}
+
+func chunkPath(id string) string {
+	return path.Join(chunksDir, id[:2], id)
+}
+
+func (r *Repository) putBlob(name string, data []byte) (int, error) {
+	blob, err := r.seal(data)
+	if err != nil {
+		return 0, err
+	}
+	return len(blob), r.writeObject(name, blob)
+}
+
+func (r *Repository) getBlob(name string) ([]byte, error) {
+	blob, err := r.readObject(name)
+	if err != nil {
+		return nil, err
+	}
+	return r.open(blob)
+}
+
+func (r *Repository) seal(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	if r.aead == nil {
+		return buf.Bytes(), nil
+	}
+	nonce := make([]byte, r.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return r.aead.Seal(nonce, nonce, buf.Bytes(), nil), nil
+}
+
+func (r *Repository) open(blob []byte) ([]byte, error) {
+	if r.aead != nil {
+		if len(blob) < r.aead.NonceSize() {
+			return nil, buserr.WithDetail(constant.ErrBackupCorrupted, "the object is truncated", nil)
+		}
+		plain, err := r.aead.Open(nil, blob[:r.aead.NonceSize()], blob[r.aead.NonceSize():], nil)
+		if err != nil {
+			return nil, buserr.WithDetail(constant.ErrBackupCorrupted, "the object failed authentication", nil)
+		}
+		blob = plain
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(blob))
+	if err != nil {
+		return nil, buserr.WithDetail(constant.ErrBackupCorrupted, err.Error(), err)
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// writeObject goes through a tmp file named after the object, the local client copies
+// the file into the target when the base names differ
+func (r *Repository) writeObject(name string, data []byte) error {
+	tmpFile := path.Join(r.tmpDir, path.Base(name))
+	if err := os.WriteFile(tmpFile, data, 0600); err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile)
+	if _, err := r.client.Upload(tmpFile, path.Join(r.dir, name)); err != nil {
+		return fmt.Errorf("upload %s failed, err: %v", name, err)
+	}
+	return nil
+}
+
+func (r *Repository) readObject(name string) ([]byte, error) {
+	tmpFile := path.Join(r.tmpDir, path.Base(name))
+	defer os.Remove(tmpFile)
+	if _, err := r.client.Download(path.Join(r.dir, name), tmpFile); err != nil {
+		return nil, fmt.Errorf("download %s failed, err: %v", name, err)
+	}
+	return os.ReadFile(tmpFile)
+}
+
+func (r *Repository) listNames(dir string) (map[string]bool, error) {
+	items, err := r.client.ListObjects(path.Join(r.dir, dir))
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for _, item := range items {
+		names[path.Base(item)] = true
+	}
+	return names, nil
+}
@@ -0,0 +1,425 @@
+package dedup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	TypeDir     = "dir"
+	TypeFile    = "file"
+	TypeSymlink = "symlink"
+)
+
+type Snapshot struct {
+	Name      string      `json:"name"`
+	Source    string      `json:"source"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Files     []FileEntry `json:"files"`
+}
+
+// FileEntry paths are relative and start with the base name of the source dir,
+// the same layout a tar archive of the source dir has
+type FileEntry struct {
+	Path    string      `json:"path"`
+	Type    string      `json:"type"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"modTime"`
+	Size    int64       `json:"size"`
+	Link    string      `json:"link,omitempty"`
+	Chunks  []string    `json:"chunks,omitempty"`
+}
+
+type Stats struct {
+	Files      int
+	Size       int64
+	Chunks     int
+	NewChunks  int
+	UploadSize int64
+}
+
+// ExcludeFunc reports whether the path relative to the source dir is left out of the backup
+type ExcludeFunc func(relPath string, isDir bool) bool
+
+// Backup stores sourceDir as snapshot name, only chunks missing from the repository are uploaded.
+// Files whose size and modification time match the parent snapshot reuse its chunks without being read.
+// The backup stops between two chunks once ctx is done, no snapshot is written then.
+func (r *Repository) Backup(ctx context.Context, sourceDir, name, parent string, exclude ExcludeFunc) (Stats, error) {
+	lock := r.lock()
+	lock.RLock()
+	defer lock.RUnlock()
+
+	var stats Stats
+	parentFiles := make(map[string]FileEntry)
+	if len(parent) != 0 {
+		if parentSnap, err := r.LoadSnapshot(parent); err == nil {
+			for _, file := range parentSnap.Files {
+				parentFiles[file.Path] = file
+			}
+		}
+	}
+	knownChunks, err := r.listNames(chunksDir)
+	if err != nil {
+		return stats, err
+	}
+
+	sourceDir = filepath.Clean(sourceDir)
+	baseName := filepath.Base(sourceDir)
+	snap := Snapshot{Name: name, Source: sourceDir, CreatedAt: time.Now()}
+	err = filepath.WalkDir(sourceDir, func(itemPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		relPath, err := filepath.Rel(sourceDir, itemPath)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if relPath != "." && exclude != nil && exclude(relPath, entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		file := FileEntry{Path: path.Join(baseName, relPath), Mode: info.Mode().Perm(), ModTime: info.ModTime()}
+		switch {
+		case info.IsDir():
+			file.Type = TypeDir
+		case info.Mode()&os.ModeSymlink != 0:
+			file.Type = TypeSymlink
+			if file.Link, err = os.Readlink(itemPath); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			file.Type = TypeFile
+			file.Size = info.Size()
+			if parentFile, ok := parentFiles[file.Path]; ok && parentFile.Type == TypeFile &&
+				parentFile.Size == file.Size && parentFile.ModTime.Equal(file.ModTime) {
+				file.Chunks = parentFile.Chunks
+			} else if file.Chunks, err = r.backupFile(ctx, itemPath, knownChunks, &stats); err != nil {
+				return err
+			}
+			stats.Size += file.Size
+			stats.Chunks += len(file.Chunks)
+		default:
+			// sockets, devices and pipes can not be restored from a backup
+			return nil
+		}
+		stats.Files++
+		snap.Files = append(snap.Files, file)
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return stats, err
+	}
+	size, err := r.putBlob(path.Join(snapshotsDir, name), data)
+	if err != nil {
+		return stats, err
+	}
+	stats.UploadSize += int64(size)
+	return stats, nil
+}
+
+func (r *Repository) backupFile(ctx context.Context, filePath string, knownChunks map[string]bool, stats *Stats) ([]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var chunks []string
+	fileChunker := newChunker(file)
+	for {
+		data, err := fileChunker.next()
+		if errors.Is(err, io.EOF) {
+			return chunks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		id := r.chunkID(data)
+		if !knownChunks[id] {
+			size, err := r.putBlob(chunkPath(id), data)
+			if err != nil {
+				return nil, err
+			}
+			knownChunks[id] = true
+			stats.NewChunks++
+			stats.UploadSize += int64(size)
+		}
+		chunks = append(chunks, id)
+	}
+}
+
+func (r *Repository) LoadSnapshot(name string) (*Snapshot, error) {
+	data, err := r.getBlob(path.Join(snapshotsDir, name))
+	if err != nil {
+		return nil, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+func (r *Repository) ListSnapshots() ([]string, error) {
+	names, err := r.listNames(snapshotsDir)
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []string
+	for name := range names {
+		snapshots = append(snapshots, name)
+	}
+	sort.Strings(snapshots)
+	return snapshots, nil
+}
+
+func (r *Repository) RemoveSnapshot(name string) error {
+	_, err := r.client.Delete(path.Join(r.dir, snapshotsDir, name))
+	return err
+}
+
+// Restore writes the snapshot into targetDir, files limits the restore to the given
+// paths of the snapshot and everything below them. Symlinks are created after all the
+// other entries and no entry is written through a symlink, a link in the snapshot or
+// already in targetDir can not redirect the restore outside of it.
+func (r *Repository) Restore(name, targetDir string, files []string) error {
+	snap, err := r.LoadSnapshot(name)
+	if err != nil {
+		return err
+	}
+	matched := make(map[string]bool)
+	var dirs, links []FileEntry
+	for _, file := range snap.Files {
+		itemPath := path.Clean(file.Path)
+		if path.IsAbs(itemPath) || itemPath == ".." || strings.HasPrefix(itemPath, "../") {
+			return fmt.Errorf("invalid path %s in snapshot %s", file.Path, name)
+		}
+		if !matchFiles(itemPath, files, matched) {
+			continue
+		}
+		if file.Type == TypeSymlink {
+			links = append(links, file)
+			continue
+		}
+		if err := checkRestorePath(targetDir, itemPath); err != nil {
+			return err
+		}
+		targetPath := path.Join(targetDir, itemPath)
+		switch file.Type {
+		case TypeDir:
+			if err := os.MkdirAll(targetPath, os.ModePerm); err != nil {
+				return err
+			}
+			dirs = append(dirs, file)
+		case TypeFile:
+			if err := r.restoreFile(file, targetPath); err != nil {
+				return fmt.Errorf("restore %s failed, err: %v", file.Path, err)
+			}
+		}
+	}
+	for _, file := range files {
+		if !matched[path.Clean(file)] {
+			return fmt.Errorf("%s is not found in snapshot %s", file, name)
+		}
+	}
+	// directory times are set last, creating the files inside them changes them again
+	for _, dir := range dirs {
+		targetPath := path.Join(targetDir, dir.Path)
+		_ = os.Chmod(targetPath, dir.Mode)
+		_ = os.Chtimes(targetPath, dir.ModTime, dir.ModTime)
+	}
+	for _, link := range links {
+		itemPath := path.Clean(link.Path)
+		if err := checkRestorePath(targetDir, itemPath); err != nil {
+			return err
+		}
+		targetPath := path.Join(targetDir, itemPath)
+		if err := os.MkdirAll(path.Dir(targetPath), os.ModePerm); err != nil {
+			return err
+		}
+		_ = os.Remove(targetPath)
+		if err := os.Symlink(link.Link, targetPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRestorePath refuses an entry when one of the directories between targetDir and it
+// is a symlink, an existing symlink at the entry itself is replaced instead of followed
+func checkRestorePath(targetDir, itemPath string) error {
+	if itemPath == "." {
+		return nil
+	}
+	parts := strings.Split(itemPath, "/")
+	currentPath := targetDir
+	for i, part := range parts {
+		currentPath = path.Join(currentPath, part)
+		info, err := os.Lstat(currentPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		if i != len(parts)-1 {
+			return fmt.Errorf("restore %s refused, %s is a symlink", itemPath, currentPath)
+		}
+		if err := os.Remove(currentPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func matchFiles(itemPath string, files []string, matched map[string]bool) bool {
+	if len(files) == 0 {
+		return true
+	}
+	for _, file := range files {
+		file = path.Clean(file)
+		if itemPath == file || strings.HasPrefix(itemPath, file+"/") {
+			matched[file] = true
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Repository) restoreFile(file FileEntry, targetPath string) error {
+	if err := os.MkdirAll(path.Dir(targetPath), os.ModePerm); err != nil {
+		return err
+	}
+	dstFile, err := os.OpenFile(targetPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+	for _, id := range file.Chunks {
+		data, err := r.getBlob(chunkPath(id))
+		if err != nil {
+			return err
+		}
+		if _, err := dstFile.Write(data); err != nil {
+			return err
+		}
+	}
+	_ = os.Chmod(targetPath, file.Mode)
+	return os.Chtimes(targetPath, file.ModTime, file.ModTime)
+}
+
+// Prune deletes the chunks no snapshot refers to any more, nothing is deleted
+// when one of the snapshots can not be loaded. It waits for the running backups
+// of the repository, their new chunks are not referenced before they finish.
+func (r *Repository) Prune() (int, error) {
+	lock := r.lock()
+	lock.Lock()
+	defer lock.Unlock()
+
+	snapshots, err := r.ListSnapshots()
+	if err != nil {
+		return 0, err
+	}
+	referenced := make(map[string]bool)
+	for _, name := range snapshots {
+		snap, err := r.LoadSnapshot(name)
+		if err != nil {
+			return 0, fmt.Errorf("load snapshot %s failed, err: %v", name, err)
+		}
+		for _, file := range snap.Files {
+			for _, id := range file.Chunks {
+				referenced[id] = true
+			}
+		}
+	}
+	chunks, err := r.listNames(chunksDir)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for id := range chunks {
+		if referenced[id] || len(id) < 2 {
+			continue
+		}
+		if _, err := r.client.Delete(path.Join(r.dir, chunkPath(id))); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Check makes sure every chunk of the snapshot exists, the full check also downloads
+// the chunks and compares their content with the chunk id, it stops once ctx is done
+func (r *Repository) Check(ctx context.Context, name string, full bool) error {
+	snap, err := r.LoadSnapshot(name)
+	if err != nil {
+		return err
+	}
+	chunks, err := r.listNames(chunksDir)
+	if err != nil {
+		return err
+	}
+	checked := make(map[string]bool)
+	missing := 0
+	for _, file := range snap.Files {
+		for _, id := range file.Chunks {
+			if checked[id] {
+				continue
+			}
+			checked[id] = true
+			if !chunks[id] {
+				missing++
+				continue
+			}
+			if !full {
+				continue
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			data, err := r.getBlob(chunkPath(id))
+			if err != nil {
+				return fmt.Errorf("chunk %s of %s is unreadable, err: %v", id, file.Path, err)
+			}
+			if r.chunkID(data) != id {
+				return fmt.Errorf("chunk %s of %s does not match its content", id, file.Path)
+			}
+		}
+	}
+	if missing != 0 {
+		return fmt.Errorf("%d of %d chunks of snapshot %s are missing", missing, len(checked), name)
+	}
+	return nil
+}
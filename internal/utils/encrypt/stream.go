@@ -0,0 +1,245 @@
+package encrypt
+
+import (
+	"LinuxOnM/internal/buserr"
+	"LinuxOnM/internal/constant"
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encrypted backup files start with a fixed header followed by AES-256-GCM sealed chunks:
+//
+//	magic(8) | salt(16) | nonce prefix(4) | key check(16) | chunk... | last chunk
+//
+// Every chunk holds up to streamChunkSize bytes of plain text, its nonce is the prefix plus
+// the chunk counter and the last chunk is authenticated with a different additional data so
+// a truncated file can not pass as a complete one.
+const (
+	streamMagic     = "LOMENC1\n"
+	streamSaltSize  = 16
+	streamPrefix    = 4
+	streamCheckSize = 16
+	streamChunkSize = 64 * 1024
+	streamHeaderLen = len(streamMagic) + streamSaltSize + streamPrefix + streamCheckSize
+)
+
+var (
+	streamAddData     = []byte{0}
+	streamLastAddData = []byte{1}
+)
+
+// IsEncryptedFile reports whether the file was written by EncryptFile
+func IsEncryptedFile(filePath string) bool {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	magic := make([]byte, len(streamMagic))
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return false
+	}
+	return string(magic) == streamMagic
+}
+
+// EncryptedSize returns the size of the file EncryptStream writes for a plain text of the given size
+func EncryptedSize(size int64) int64 {
+	chunks := size / streamChunkSize
+	if size%streamChunkSize != 0 || size == 0 {
+		chunks++
+	}
+	return int64(streamHeaderLen) + size + chunks*16
+}
+
+// IsEncryptedReader peeks at the start of the stream without consuming it
+func IsEncryptedReader(reader *bufio.Reader) bool {
+	magic, err := reader.Peek(len(streamMagic))
+	return err == nil && string(magic) == streamMagic
+}
+
+func EncryptFile(src, dst, passphrase string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	if err := EncryptStream(srcFile, dstFile, passphrase); err != nil {
+		return err
+	}
+	return dstFile.Sync()
+}
+
+func DecryptFile(src, dst, passphrase string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	if err := DecryptStream(srcFile, dstFile, passphrase); err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+func EncryptStream(reader io.Reader, writer io.Writer, passphrase string) error {
+	header := make([]byte, streamHeaderLen)
+	copy(header, streamMagic)
+	salt := header[len(streamMagic) : len(streamMagic)+streamSaltSize]
+	prefix := header[len(streamMagic)+streamSaltSize : len(streamMagic)+streamSaltSize+streamPrefix]
+	if _, err := io.ReadFull(rand.Reader, header[len(streamMagic):len(streamMagic)+streamSaltSize+streamPrefix]); err != nil {
+		return err
+	}
+	aead, check, err := newStreamCipher(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	copy(header[streamHeaderLen-streamCheckSize:], check)
+	if _, err := writer.Write(header); err != nil {
+		return err
+	}
+
+	var counter uint64
+	buf := make([]byte, streamChunkSize)
+	next := make([]byte, streamChunkSize)
+	n, err := readChunk(reader, buf)
+	if err != nil {
+		return err
+	}
+	for {
+		last := n < streamChunkSize
+		m := 0
+		if !last {
+			if m, err = readChunk(reader, next); err != nil {
+				return err
+			}
+			last = m == 0
+		}
+		addData := streamAddData
+		if last {
+			addData = streamLastAddData
+		}
+		if _, err := writer.Write(aead.Seal(nil, streamNonce(prefix, counter), buf[:n], addData)); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		counter++
+		buf, next = next, buf
+		n = m
+	}
+}
+
+func DecryptStream(reader io.Reader, writer io.Writer, passphrase string) error {
+	header := make([]byte, streamHeaderLen)
+	if _, err := io.ReadFull(reader, header); err != nil || string(header[:len(streamMagic)]) != streamMagic {
+		return buserr.WithDetail(constant.ErrBackupNotEncrypted, "the file is not an encrypted backup", nil)
+	}
+	salt := header[len(streamMagic) : len(streamMagic)+streamSaltSize]
+	prefix := header[len(streamMagic)+streamSaltSize : len(streamMagic)+streamSaltSize+streamPrefix]
+	aead, check, err := newStreamCipher(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(check, header[streamHeaderLen-streamCheckSize:]) {
+		return buserr.WithDetail(constant.ErrBackupDecryptKey, "the passphrase does not match the one used to encrypt the backup", nil)
+	}
+
+	var counter uint64
+	bufReader := bufio.NewReaderSize(reader, streamChunkSize+aead.Overhead())
+	buf := make([]byte, streamChunkSize+aead.Overhead())
+	for {
+		n, err := readChunk(bufReader, buf)
+		if err != nil {
+			return err
+		}
+		_, peekErr := bufReader.Peek(1)
+		last := errors.Is(peekErr, io.EOF)
+		addData := streamAddData
+		if last {
+			addData = streamLastAddData
+		}
+		plain, err := aead.Open(buf[:0], streamNonce(prefix, counter), buf[:n], addData)
+		if err != nil {
+			return buserr.WithDetail(constant.ErrBackupCorrupted, fmt.Sprintf("chunk %d failed authentication, the file is damaged or truncated", counter), nil)
+		}
+		if _, err := writer.Write(plain); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		counter++
+	}
+}
+
+func newStreamCipher(passphrase string, salt []byte) (cipher.AEAD, []byte, error) {
+	if len(passphrase) == 0 {
+		return nil, nil, buserr.WithDetail(constant.ErrBackupEncryptKey, "the backup is encrypted but no passphrase is configured", nil)
+	}
+	aead, macKey, err := DeriveCipher(passphrase, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write([]byte(streamMagic))
+	return aead, mac.Sum(nil)[:streamCheckSize], nil
+}
+
+// DeriveCipher derives an AES-256-GCM cipher and a 32 byte mac key from the passphrase with scrypt,
+// the encrypted backup files and the dedup repositories share the parameters
+func DeriveCipher(passphrase string, salt []byte) (cipher.AEAD, []byte, error) {
+	keys, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 64)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, err := aes.NewCipher(keys[:32])
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, keys[32:], nil
+}
+
+func streamNonce(prefix []byte, counter uint64) []byte {
+	nonce := bytes.NewBuffer(make([]byte, 0, streamPrefix+8))
+	nonce.Write(prefix)
+	_ = binary.Write(nonce, binary.BigEndian, counter)
+	return nonce.Bytes()
+}
+
+func readChunk(reader io.Reader, buf []byte) (int, error) {
+	n, err := io.ReadFull(reader, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return n, nil
+	}
+	return n, err
+}
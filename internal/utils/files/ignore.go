@@ -0,0 +1,114 @@
+package files
+
+import (
+	"path"
+	"strings"
+)
+
+// IgnoreRules matches paths against gitignore style rules, one rule per line (commas separate
+// rules as well). Rules without a slash match the name at any depth, rules with a slash are
+// relative to the root, a trailing slash only matches directories, "**" matches any number of
+// directories and "!" re-includes a path excluded by an earlier rule. The last matching rule wins.
+type IgnoreRules struct {
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+func NewIgnoreRules(content string) *IgnoreRules {
+	rules := &IgnoreRules{}
+	for _, line := range strings.FieldsFunc(content, func(r rune) bool { return r == '\n' || r == ',' }) {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, "\\")
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		rule.anchored = strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if len(line) == 0 {
+			continue
+		}
+		rule.segments = strings.Split(line, "/")
+		rules.rules = append(rules.rules, rule)
+	}
+	return rules
+}
+
+func (r *IgnoreRules) Empty() bool {
+	return r == nil || len(r.rules) == 0
+}
+
+// Match reports whether the slash separated path relative to the root is excluded,
+// a path below an excluded directory stays excluded like it does for git
+func (r *IgnoreRules) Match(relPath string, isDir bool) bool {
+	if r.Empty() {
+		return false
+	}
+	parts := strings.Split(path.Clean(relPath), "/")
+	for i := 1; i < len(parts); i++ {
+		if r.matchPath(parts[:i], true) {
+			return true
+		}
+	}
+	return r.matchPath(parts, isDir)
+}
+
+func (r *IgnoreRules) matchPath(parts []string, isDir bool) bool {
+	excluded := false
+	for _, rule := range r.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.match(parts) {
+			excluded = !rule.negate
+		}
+	}
+	return excluded
+}
+
+func (rule ignoreRule) match(parts []string) bool {
+	if rule.anchored {
+		return matchSegments(rule.segments, parts)
+	}
+	name, err := path.Match(rule.segments[0], parts[len(parts)-1])
+	return err == nil && name
+}
+
+func matchSegments(patterns, parts []string) bool {
+	if len(patterns) == 0 {
+		return len(parts) == 0
+	}
+	if patterns[0] == "**" {
+		// a trailing "**" matches everything inside the directory but not the directory itself
+		if len(patterns) == 1 {
+			return len(parts) != 0
+		}
+		for i := 0; i <= len(parts); i++ {
+			if matchSegments(patterns[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	if ok, err := path.Match(patterns[0], parts[0]); err != nil || !ok {
+		return false
+	}
+	return matchSegments(patterns[1:], parts[1:])
+}
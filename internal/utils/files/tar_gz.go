@@ -3,7 +3,12 @@ package files
 import (
 	"LinuxOnM/internal/global"
 	"LinuxOnM/internal/utils/cmd"
+	"bytes"
+	"context"
 	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 )
@@ -16,24 +21,25 @@ func NewTarGzArchiver() ShellArchiver {
 }
 
 func (t TarGzArchiver) Compress(sourcePaths []string, dstFile string, secret string) error {
-	var itemDirs []string
-	for _, item := range sourcePaths {
-		itemDirs = append(itemDirs, fmt.Sprintf("\"%s\"", filepath.Base(item)))
-	}
-	itemDir := strings.Join(itemDirs, " ")
 	aheadDir := filepath.Dir(sourcePaths[0])
 	if len(aheadDir) == 0 {
 		aheadDir = "/"
 	}
-	commands := ""
 	if len(secret) != 0 {
-		extraCmd := fmt.Sprintf("| openssl enc -aes-256-cbc -salt -k '%s' -out '%s'", secret, dstFile)
-		commands = fmt.Sprintf("tar -zcf - -C \"%s\" %s %s", aheadDir, itemDir, extraCmd)
-		global.LOG.Debug(strings.ReplaceAll(commands, fmt.Sprintf(" %s ", secret), "******"))
-	} else {
-		commands = fmt.Sprintf("tar -zcf \"%s\" -C \"%s\" %s", dstFile, aheadDir, itemDir)
-		global.LOG.Debug(commands)
+		tarArgs := []string{"-zcf", "-", "-C", aheadDir, "--"}
+		for _, item := range sourcePaths {
+			tarArgs = append(tarArgs, filepath.Base(item))
+		}
+		encCmd := exec.Command("openssl", "enc", "-aes-256-cbc", "-salt", "-pass", "env:"+archiveSecretEnv, "-out", dstFile)
+		encCmd.Env = append(os.Environ(), archiveSecretEnv+"="+secret)
+		return runPipe(exec.Command("tar", tarArgs...), encCmd)
+	}
+	var itemDirs []string
+	for _, item := range sourcePaths {
+		itemDirs = append(itemDirs, fmt.Sprintf("\"%s\"", filepath.Base(item)))
 	}
+	commands := fmt.Sprintf("tar -zcf \"%s\" -C \"%s\" %s", dstFile, aheadDir, strings.Join(itemDirs, " "))
+	global.LOG.Debug(commands)
 	if err := cmd.ExecCmd(commands); err != nil {
 		return err
 	}
@@ -41,18 +47,115 @@ func (t TarGzArchiver) Compress(sourcePaths []string, dstFile string, secret str
 }
 
 func (t TarGzArchiver) Extract(filePath, dstDir string, secret string) error {
-	var err error
-	commands := ""
 	if len(secret) != 0 {
-		extraCmd := fmt.Sprintf("openssl enc -d -aes-256-cbc -k '%s' -in '%s' | ", secret, filePath)
-		commands = fmt.Sprintf("%s tar -zxvf - -C '%s' > /dev/null 2>&1", extraCmd, dstDir)
-		global.LOG.Debug(strings.ReplaceAll(commands, fmt.Sprintf(" %s ", secret), "******"))
-	} else {
-		commands = fmt.Sprintf("tar -zxvf '%s' -C '%s' > /dev/null 2>&1", filePath, dstDir)
-		global.LOG.Debug(commands)
-	}
-	if err = cmd.ExecCmd(commands); err != nil {
+		return extractEncrypted(filePath, dstDir, secret)
+	}
+	commands := fmt.Sprintf("tar -zxvf '%s' -C '%s' > /dev/null 2>&1", filePath, dstDir)
+	global.LOG.Debug(commands)
+	if err := cmd.ExecCmd(commands); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CompressDir packs sourceDir like Compress does, paths the exclude func reports are left out.
+// The kept paths are handed to tar as a list so tar does not descend into excluded directories.
+// Nothing is run through a shell and the secret only reaches openssl through its environment,
+// tar and openssl are killed once ctx is done.
+func (t TarGzArchiver) CompressDir(ctx context.Context, sourceDir, dstFile, secret string, exclude func(relPath string, isDir bool) bool) error {
+	sourceDir = filepath.Clean(sourceDir)
+	baseName := filepath.Base(sourceDir)
+	var names []string
+	err := filepath.WalkDir(sourceDir, func(itemPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		relPath, err := filepath.Rel(sourceDir, itemPath)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if relPath != "." && exclude != nil && exclude(relPath, entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		names = append(names, filepath.Join(baseName, relPath))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	listFile := dstFile + ".list"
+	if err := os.WriteFile(listFile, []byte(strings.Join(names, "\x00")), 0600); err != nil {
+		return err
+	}
+	defer os.Remove(listFile)
+
+	aheadDir := filepath.Dir(sourceDir)
+	if len(secret) == 0 {
+		tarCmd := exec.CommandContext(ctx, "tar", "--no-recursion", "--null", "-zcf", dstFile, "-C", aheadDir, "-T", listFile)
+		global.LOG.Debug(tarCmd.String())
+		if output, err := tarCmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("error : %v, output: %s", err, output)
+		}
+		return nil
+	}
+	tarCmd := exec.CommandContext(ctx, "tar", "--no-recursion", "--null", "-zcf", "-", "-C", aheadDir, "-T", listFile)
+	encCmd := exec.CommandContext(ctx, "openssl", "enc", "-aes-256-cbc", "-salt", "-pass", "env:"+archiveSecretEnv, "-out", dstFile)
+	encCmd.Env = append(os.Environ(), archiveSecretEnv+"="+secret)
+	return runPipe(tarCmd, encCmd)
+}
+
+// archiveSecretEnv hands the secret to openssl, -pass env: derives the same key as -k
+const archiveSecretEnv = "LINUXONM_ARCHIVE_SECRET"
+
+func extractEncrypted(filePath, dstDir, secret string) error {
+	decCmd := exec.Command("openssl", "enc", "-d", "-aes-256-cbc", "-pass", "env:"+archiveSecretEnv, "-in", filePath)
+	decCmd.Env = append(os.Environ(), archiveSecretEnv+"="+secret)
+	tarCmd := exec.Command("tar", "-zxf", "-", "-C", dstDir)
+	return runPipe(decCmd, tarCmd)
+}
+
+// runPipe runs src | dst without a shell, the parent closes its pipe ends so that
+// either side sees the other one exit instead of blocking on the pipe
+func runPipe(src, dst *exec.Cmd) error {
+	global.LOG.Debug(src.String() + " | " + dst.String())
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	var srcOut, dstOut bytes.Buffer
+	src.Stdout = writer
+	src.Stderr = &srcOut
+	dst.Stdin = reader
+	dst.Stdout = &dstOut
+	dst.Stderr = &dstOut
+	if err := src.Start(); err != nil {
+		_ = reader.Close()
+		_ = writer.Close()
 		return err
 	}
+	if err := dst.Start(); err != nil {
+		_ = reader.Close()
+		_ = writer.Close()
+		_ = src.Process.Kill()
+		_ = src.Wait()
+		return err
+	}
+	_ = reader.Close()
+	_ = writer.Close()
+	srcErr := src.Wait()
+	dstErr := dst.Wait()
+	if srcErr != nil {
+		return fmt.Errorf("error : %v, output: %s", srcErr, srcOut.String())
+	}
+	if dstErr != nil {
+		return fmt.Errorf("error : %v, output: %s", dstErr, dstOut.String())
+	}
 	return nil
 }
@@ -3,6 +3,7 @@ package client
 import (
 	"LinuxOnM/internal/global"
 	"fmt"
+	"strings"
 )
 
 func loadParamFromVars(key string, vars map[string]interface{}) string {
@@ -15,3 +16,8 @@ func loadParamFromVars(key string, vars map[string]interface{}) string {
 
 	return fmt.Sprintf("%v", vars[key])
 }
+
+// loadObjectKey returns the path of a file relative to the root of the storage, the way s3 lists its keys
+func loadObjectKey(root, filePath string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(filePath, root), "/")
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"LinuxOnM/internal/utils/common"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
@@ -77,6 +78,41 @@ func (c localClient) Download(src, target string) (bool, error) {
 	return true, nil
 }
 
+func (c localClient) UploadStream(reader io.Reader, size int64, target string) (bool, error) {
+	targetFilePath := path.Join(c.dir, target)
+	if err := os.MkdirAll(path.Dir(targetFilePath), os.ModePerm); err != nil {
+		return false, err
+	}
+	file, err := os.OpenFile(targetFilePath+"_temp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(file, reader); err != nil {
+		_ = file.Close()
+		_ = os.Remove(targetFilePath + "_temp")
+		return false, fmt.Errorf("upload file failed, err: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return false, err
+	}
+	if err := os.Rename(targetFilePath+"_temp", targetFilePath); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (c localClient) DownloadStream(src string, writer io.Writer) (bool, error) {
+	file, err := os.Open(path.Join(c.dir, src))
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	if _, err := io.Copy(writer, file); err != nil {
+		return false, fmt.Errorf("download file failed, err: %v", err)
+	}
+	return true, nil
+}
+
 func (c localClient) ListObjects(prefix string) ([]string, error) {
 	var files []string
 	itemPath := path.Join(c.dir, prefix)
@@ -84,8 +120,11 @@ func (c localClient) ListObjects(prefix string) ([]string, error) {
 		return files, nil
 	}
 	if err := filepath.Walk(itemPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
 		if !info.IsDir() {
-			files = append(files, info.Name())
+			files = append(files, loadObjectKey(c.dir, path))
 		}
 		return nil
 	}); err != nil {
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const s3MinPartSize = 5 * 1024 * 1024
+
+type s3Client struct {
+	bucket   string
+	partSize uint64
+	client   *minio.Client
+}
+
+func NewS3Client(vars map[string]interface{}) (*s3Client, error) {
+	accessKey := loadParamFromVars("accessKey", vars)
+	secretKey := loadParamFromVars("secretKey", vars)
+	endpoint := loadParamFromVars("endpoint", vars)
+	region := loadParamFromVars("region", vars)
+	bucket := loadParamFromVars("bucket", vars)
+
+	secure := true
+	switch {
+	case strings.HasPrefix(endpoint, "http://"):
+		secure = false
+		endpoint = strings.TrimPrefix(endpoint, "http://")
+	case strings.HasPrefix(endpoint, "https://"):
+		endpoint = strings.TrimPrefix(endpoint, "https://")
+	}
+	endpoint = strings.TrimSuffix(endpoint, "/")
+
+	lookup := minio.BucketLookupAuto
+	if pathStyle, ok := vars["pathStyle"]; ok {
+		if isPath, _ := strconv.ParseBool(fmt.Sprintf("%v", pathStyle)); isPath {
+			lookup = minio.BucketLookupPath
+		} else {
+			lookup = minio.BucketLookupDNS
+		}
+	}
+
+	// multipartThreshold is configured in MB, objects not larger than it are uploaded in a single request
+	var partSize uint64
+	if threshold, ok := vars["multipartThreshold"]; ok {
+		size, _ := strconv.ParseUint(fmt.Sprintf("%v", threshold), 10, 64)
+		partSize = size * 1024 * 1024
+		if partSize != 0 && partSize < s3MinPartSize {
+			partSize = s3MinPartSize
+		}
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure:       secure,
+		Region:       region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s3Client{bucket: bucket, partSize: partSize, client: client}, nil
+}
+
+func (s s3Client) ListBuckets() ([]interface{}, error) {
+	var result []interface{}
+	buckets, err := s.client.ListBuckets(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	for _, bucket := range buckets {
+		result = append(result, bucket.Name)
+	}
+	return result, nil
+}
+
+func (s s3Client) Exist(file string) (bool, error) {
+	if _, err := s.client.StatObject(context.Background(), s.bucket, file, minio.StatObjectOptions{}); err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s s3Client) Size(file string) (int64, error) {
+	info, err := s.client.StatObject(context.Background(), s.bucket, file, minio.StatObjectOptions{})
+	if err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+func (s s3Client) Delete(file string) (bool, error) {
+	if err := s.client.RemoveObject(context.Background(), s.bucket, file, minio.RemoveObjectOptions{}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s s3Client) Upload(src, target string) (bool, error) {
+	if _, err := s.client.FPutObject(context.Background(), s.bucket, target, src, minio.PutObjectOptions{PartSize: s.partSize}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s s3Client) Download(src, target string) (bool, error) {
+	if _, err := os.Stat(path.Dir(target)); err != nil {
+		if os.IsNotExist(err) {
+			if err = os.MkdirAll(path.Dir(target), os.ModePerm); err != nil {
+				return false, err
+			}
+		} else {
+			return false, err
+		}
+	}
+	if err := s.client.FGetObject(context.Background(), s.bucket, src, target, minio.GetObjectOptions{}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// UploadStream puts objects of unknown size (-1) in parts, the part size falls back to the minio default
+func (s s3Client) UploadStream(reader io.Reader, size int64, target string) (bool, error) {
+	if _, err := s.client.PutObject(context.Background(), s.bucket, target, reader, size, minio.PutObjectOptions{PartSize: s.partSize}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s s3Client) DownloadStream(src string, writer io.Writer) (bool, error) {
+	object, err := s.client.GetObject(context.Background(), s.bucket, src, minio.GetObjectOptions{})
+	if err != nil {
+		return false, err
+	}
+	defer object.Close()
+	if _, err := io.Copy(writer, object); err != nil {
+		return false, fmt.Errorf("download file failed, err: %v", err)
+	}
+	return true, nil
+}
+
+func (s s3Client) ListObjects(prefix string) ([]string, error) {
+	var result []string
+	for object := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		result = append(result, object.Key)
+	}
+	return result, nil
+}
@@ -0,0 +1,215 @@
+package client
+
+import (
+	"LinuxOnM/internal/utils/ssh"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/pkg/sftp"
+)
+
+type sftpClient struct {
+	bucket   string
+	connInfo ssh.ConnInfo
+}
+
+func NewSftpClient(vars map[string]interface{}) (*sftpClient, error) {
+	address := loadParamFromVars("address", vars)
+	port, err := strconv.Atoi(loadParamFromVars("port", vars))
+	if err != nil || port == 0 {
+		port = 22
+	}
+	authMode := loadParamFromVars("authMode", vars)
+	username := loadParamFromVars("username", vars)
+	password := loadParamFromVars("password", vars)
+	bucket := loadParamFromVars("bucket", vars)
+
+	connInfo := ssh.ConnInfo{Addr: address, Port: port, User: username, AuthMode: authMode}
+	if authMode == "key" {
+		connInfo.PrivateKey = []byte(password)
+		if passPhrase, ok := vars["passPhrase"]; ok {
+			connInfo.PassPhrase = []byte(fmt.Sprintf("%v", passPhrase))
+		}
+	} else {
+		connInfo.AuthMode = "password"
+		connInfo.Password = password
+	}
+	return &sftpClient{bucket: bucket, connInfo: connInfo}, nil
+}
+
+func (s sftpClient) ListBuckets() ([]interface{}, error) {
+	return nil, nil
+}
+
+func (s sftpClient) Exist(file string) (bool, error) {
+	client, err := s.connect()
+	if err != nil {
+		return false, err
+	}
+	defer client.close()
+
+	if _, err := client.sftp.Stat(path.Join(s.bucket, file)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s sftpClient) Size(file string) (int64, error) {
+	client, err := s.connect()
+	if err != nil {
+		return 0, err
+	}
+	defer client.close()
+
+	fileInfo, err := client.sftp.Stat(path.Join(s.bucket, file))
+	if err != nil {
+		return 0, err
+	}
+	return fileInfo.Size(), nil
+}
+
+func (s sftpClient) Delete(file string) (bool, error) {
+	client, err := s.connect()
+	if err != nil {
+		return false, err
+	}
+	defer client.close()
+
+	if err := client.sftp.RemoveAll(path.Join(s.bucket, file)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s sftpClient) Upload(src, target string) (bool, error) {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return false, err
+	}
+	defer srcFile.Close()
+	info, err := srcFile.Stat()
+	if err != nil {
+		return false, err
+	}
+	return s.UploadStream(srcFile, info.Size(), target)
+}
+
+func (s sftpClient) UploadStream(reader io.Reader, size int64, target string) (bool, error) {
+	client, err := s.connect()
+	if err != nil {
+		return false, err
+	}
+	defer client.close()
+
+	targetFilePath := path.Join(s.bucket, target)
+	if err := client.sftp.MkdirAll(path.Dir(targetFilePath)); err != nil {
+		return false, err
+	}
+	dstFile, err := client.sftp.Create(targetFilePath)
+	if err != nil {
+		return false, err
+	}
+	defer dstFile.Close()
+
+	if _, err := io.Copy(dstFile, reader); err != nil {
+		return false, fmt.Errorf("upload file failed, err: %v", err)
+	}
+	return true, nil
+}
+
+func (s sftpClient) Download(src, target string) (bool, error) {
+	if _, err := os.Stat(path.Dir(target)); err != nil {
+		if os.IsNotExist(err) {
+			if err = os.MkdirAll(path.Dir(target), os.ModePerm); err != nil {
+				return false, err
+			}
+		} else {
+			return false, err
+		}
+	}
+	dstFile, err := os.Create(target)
+	if err != nil {
+		return false, err
+	}
+	defer dstFile.Close()
+	return s.DownloadStream(src, dstFile)
+}
+
+func (s sftpClient) DownloadStream(src string, writer io.Writer) (bool, error) {
+	client, err := s.connect()
+	if err != nil {
+		return false, err
+	}
+	defer client.close()
+
+	srcFile, err := client.sftp.Open(path.Join(s.bucket, src))
+	if err != nil {
+		return false, err
+	}
+	defer srcFile.Close()
+
+	if _, err := io.Copy(writer, srcFile); err != nil {
+		return false, fmt.Errorf("download file failed, err: %v", err)
+	}
+	return true, nil
+}
+
+func (s sftpClient) ListObjects(prefix string) ([]string, error) {
+	client, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer client.close()
+
+	var files []string
+	itemPath := path.Join(s.bucket, prefix)
+	if _, err := client.sftp.Stat(itemPath); err != nil {
+		if os.IsNotExist(err) {
+			return files, nil
+		}
+		return nil, err
+	}
+	walker := client.sftp.Walk(itemPath)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return nil, err
+		}
+		if !walker.Stat().IsDir() {
+			files = append(files, loadObjectKey(s.bucket, walker.Path()))
+		}
+	}
+	return files, nil
+}
+
+type sftpConn struct {
+	ssh  *ssh.ConnInfo
+	sftp *sftp.Client
+}
+
+func (c sftpConn) close() {
+	_ = c.sftp.Close()
+	c.ssh.Close()
+}
+
+// connect dials a new session for every operation, ConnInfo.NewClient rewrites the address
+// so it always works on a copy of the stored connection info
+func (s sftpClient) connect() (*sftpConn, error) {
+	connInfo := s.connInfo
+	sshClient, err := connInfo.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	sftpItem, err := sftp.NewClient(sshClient.Client)
+	if err != nil {
+		sshClient.Close()
+		return nil, err
+	}
+	return &sftpConn{ssh: sshClient, sftp: sftpItem}, nil
+}
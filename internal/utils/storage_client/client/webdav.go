@@ -0,0 +1,175 @@
+package client
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/studio-b12/gowebdav"
+)
+
+type webDAVClient struct {
+	bucket string
+	client *gowebdav.Client
+}
+
+func NewWebDAVClient(vars map[string]interface{}) (*webDAVClient, error) {
+	address := loadParamFromVars("address", vars)
+	port := loadParamFromVars("port", vars)
+	username := loadParamFromVars("username", vars)
+	password := loadParamFromVars("password", vars)
+	bucket := loadParamFromVars("bucket", vars)
+
+	url := strings.TrimSuffix(address, "/")
+	if len(port) != 0 && port != "0" {
+		url = fmt.Sprintf("%s:%s", url, port)
+	}
+
+	var client *gowebdav.Client
+	if authType, ok := vars["authType"]; ok && fmt.Sprintf("%v", authType) == "basic" {
+		client = gowebdav.NewAuthClient(url, gowebdav.NewEmptyAuth())
+		client.SetHeader("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+	} else {
+		// the auto authorizer answers both basic and digest challenges sent by the server
+		client = gowebdav.NewClient(url, username, password)
+	}
+	if skipVerify, ok := vars["skipVerify"]; ok {
+		if isSkip, _ := strconv.ParseBool(fmt.Sprintf("%v", skipVerify)); isSkip {
+			client.SetTransport(&http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			})
+		}
+	}
+	if err := client.Connect(); err != nil {
+		return nil, err
+	}
+	return &webDAVClient{bucket: bucket, client: client}, nil
+}
+
+func (w webDAVClient) ListBuckets() ([]interface{}, error) {
+	return nil, nil
+}
+
+func (w webDAVClient) Exist(file string) (bool, error) {
+	if _, err := w.client.Stat(path.Join(w.bucket, file)); err != nil {
+		if gowebdav.IsErrNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (w webDAVClient) Size(file string) (int64, error) {
+	fileInfo, err := w.client.Stat(path.Join(w.bucket, file))
+	if err != nil {
+		return 0, err
+	}
+	return fileInfo.Size(), nil
+}
+
+func (w webDAVClient) Delete(file string) (bool, error) {
+	if err := w.client.RemoveAll(path.Join(w.bucket, file)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (w webDAVClient) Upload(src, target string) (bool, error) {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return false, err
+	}
+	defer srcFile.Close()
+	info, err := srcFile.Stat()
+	if err != nil {
+		return false, err
+	}
+	return w.UploadStream(srcFile, info.Size(), target)
+}
+
+func (w webDAVClient) UploadStream(reader io.Reader, size int64, target string) (bool, error) {
+	targetFilePath := path.Join(w.bucket, target)
+	if err := w.client.MkdirAll(path.Dir(targetFilePath), os.ModePerm); err != nil {
+		return false, err
+	}
+	if err := w.client.WriteStream(targetFilePath, reader, os.ModePerm); err != nil {
+		return false, fmt.Errorf("upload file failed, err: %v", err)
+	}
+	return true, nil
+}
+
+func (w webDAVClient) Download(src, target string) (bool, error) {
+	if _, err := os.Stat(path.Dir(target)); err != nil {
+		if os.IsNotExist(err) {
+			if err = os.MkdirAll(path.Dir(target), os.ModePerm); err != nil {
+				return false, err
+			}
+		} else {
+			return false, err
+		}
+	}
+	file, err := os.Create(target)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	return w.DownloadStream(src, file)
+}
+
+func (w webDAVClient) DownloadStream(src string, writer io.Writer) (bool, error) {
+	reader, err := w.client.ReadStream(path.Join(w.bucket, src))
+	if err != nil {
+		return false, err
+	}
+	defer reader.Close()
+
+	if _, err := io.Copy(writer, reader); err != nil {
+		return false, fmt.Errorf("download file failed, err: %v", err)
+	}
+	return true, nil
+}
+
+func (w webDAVClient) ListObjects(prefix string) ([]string, error) {
+	var files []string
+	itemPath := path.Join(w.bucket, prefix)
+	fileInfo, err := w.client.Stat(itemPath)
+	if err != nil {
+		if gowebdav.IsErrNotFound(err) {
+			return files, nil
+		}
+		return nil, err
+	}
+	if !fileInfo.IsDir() {
+		return append(files, loadObjectKey(w.bucket, itemPath)), nil
+	}
+	if err := w.walk(itemPath, &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// walk lists the directory level by level, each ReadDir call is a PROPFIND request with depth 1
+func (w webDAVClient) walk(dir string, files *[]string) error {
+	items, err := w.client.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if item.IsDir() {
+			if err := w.walk(path.Join(dir, item.Name()), files); err != nil {
+				return err
+			}
+			continue
+		}
+		*files = append(*files, loadObjectKey(w.bucket, path.Join(dir, item.Name())))
+	}
+	return nil
+}
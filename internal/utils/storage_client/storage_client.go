@@ -3,6 +3,7 @@ package storage_client
 import (
 	"LinuxOnM/internal/constant"
 	"LinuxOnM/internal/utils/storage_client/client"
+	"io"
 )
 
 type StorageClient interface {
@@ -12,6 +13,8 @@ type StorageClient interface {
 	Delete(path string) (bool, error)
 	Upload(src, target string) (bool, error)
 	Download(src, target string) (bool, error)
+	UploadStream(reader io.Reader, size int64, target string) (bool, error)
+	DownloadStream(src string, writer io.Writer) (bool, error)
 
 	Size(path string) (int64, error)
 }
@@ -20,6 +23,12 @@ func NewStorageClient(backupType string, vars map[string]interface{}) (StorageCl
 	switch backupType {
 	case constant.Local:
 		return client.NewLocalClient(vars)
+	case constant.S3:
+		return client.NewS3Client(vars)
+	case constant.Sftp:
+		return client.NewSftpClient(vars)
+	case constant.WebDAV:
+		return client.NewWebDAVClient(vars)
 	default:
 		return nil, constant.ErrNotSupportType
 	}
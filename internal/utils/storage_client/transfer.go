@@ -0,0 +1,103 @@
+package storage_client
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+)
+
+// ProgressFunc receives the bytes transferred so far and the total size, total is 0 when it is unknown
+type ProgressFunc func(transferred, total int64)
+
+type TransferProcess struct {
+	Key         string  `json:"key"`
+	Type        string  `json:"type"`
+	Account     string  `json:"account"`
+	Name        string  `json:"name"`
+	Total       int64   `json:"total"`
+	Transferred int64   `json:"transferred"`
+	Percent     float64 `json:"percent"`
+	Status      string  `json:"status"`
+	Message     string  `json:"message"`
+}
+
+func UploadWithProgress(ctx context.Context, client StorageClient, src, target string, progress ProgressFunc) (bool, error) {
+	file, err := os.Open(src)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	return UploadStreamWithProgress(ctx, client, file, info.Size(), target, progress)
+}
+
+// UploadStreamWithProgress reports the progress while the client reads the stream,
+// the transfer stops with the context error once ctx is cancelled
+func UploadStreamWithProgress(ctx context.Context, client StorageClient, reader io.Reader, size int64, target string, progress ProgressFunc) (bool, error) {
+	return client.UploadStream(&progressReader{ctx: ctx, reader: reader, total: size, progress: progress}, size, target)
+}
+
+func DownloadWithProgress(ctx context.Context, client StorageClient, src, target string, progress ProgressFunc) (bool, error) {
+	if err := os.MkdirAll(path.Dir(target), os.ModePerm); err != nil {
+		return false, err
+	}
+	file, err := os.Create(target)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	ok, err := DownloadStreamWithProgress(ctx, client, src, file, progress)
+	if err != nil {
+		_ = os.Remove(target)
+	}
+	return ok, err
+}
+
+func DownloadStreamWithProgress(ctx context.Context, client StorageClient, src string, writer io.Writer, progress ProgressFunc) (bool, error) {
+	total, _ := client.Size(src)
+	return client.DownloadStream(src, &progressWriter{ctx: ctx, writer: writer, total: total, progress: progress})
+}
+
+type progressReader struct {
+	ctx         context.Context
+	reader      io.Reader
+	total       int64
+	transferred int64
+	progress    ProgressFunc
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.reader.Read(p)
+	r.transferred += int64(n)
+	if r.progress != nil && n != 0 {
+		r.progress(r.transferred, r.total)
+	}
+	return n, err
+}
+
+type progressWriter struct {
+	ctx         context.Context
+	writer      io.Writer
+	total       int64
+	transferred int64
+	progress    ProgressFunc
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := w.writer.Write(p)
+	w.transferred += int64(n)
+	if w.progress != nil && n != 0 {
+		w.progress(w.transferred, w.total)
+	}
+	return n, err
+}
@@ -4,6 +4,7 @@ import (
 	"LinuxOnM/internal/global"
 	"LinuxOnM/internal/utils/common"
 	"LinuxOnM/internal/utils/files"
+	"LinuxOnM/internal/utils/storage_client"
 	"encoding/json"
 	"fmt"
 	"sort"
@@ -110,6 +111,12 @@ func ProcessData(c *Client, inputMsg []byte) {
 			return
 		}
 		c.Msg <- res
+	case "transfer":
+		res, err := getTransferProcess(wsInput.DownloadProgress)
+		if err != nil {
+			return
+		}
+		c.Msg <- res
 	case "ps":
 		res, err := getProcessData(wsInput.PsProcessConfig)
 		if err != nil {
@@ -148,6 +155,22 @@ func getDownloadProcess(progress DownloadProgress) (res []byte, err error) {
 	return
 }
 
+func getTransferProcess(progress DownloadProgress) (res []byte, err error) {
+	var result []storage_client.TransferProcess
+	for _, k := range progress.Keys {
+		value, err := global.CACHE.Get(k)
+		if err != nil {
+			global.LOG.Errorf("get cache error,err %s", err.Error())
+			return nil, err
+		}
+		transferProcess := &storage_client.TransferProcess{}
+		_ = json.Unmarshal(value, transferProcess)
+		result = append(result, *transferProcess)
+	}
+	res, err = json.Marshal(result)
+	return
+}
+
 func getProcessData(processConfig PsProcessConfig) (res []byte, err error) {
 	var processes []*process.Process
 	processes, err = process.Processes()